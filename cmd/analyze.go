@@ -16,160 +16,196 @@ limitations under the License.
 package cmd
 
 import (
+	"errors"
 	"fmt"
-	"io"
 	"os"
 	"path/filepath"
+	"runtime"
 	"strings"
 
 	"github.com/alegrey91/harpoon/internal/analyzer"
 	"github.com/alegrey91/harpoon/internal/archiver"
+	"github.com/alegrey91/harpoon/internal/buildcache"
+	"github.com/alegrey91/harpoon/internal/coverage"
 	"github.com/alegrey91/harpoon/internal/elfreader"
 	"github.com/alegrey91/harpoon/internal/executor"
 	"github.com/alegrey91/harpoon/internal/metadata"
+	"github.com/alegrey91/harpoon/internal/policy"
+	"github.com/alegrey91/harpoon/internal/testgraph"
 	"github.com/spf13/cobra"
+	"golang.org/x/sync/errgroup"
+	"golang.org/x/tools/cover"
 )
 
 var (
 	excludeList        []string
 	saveAnalysis       bool
 	analysisReportFile = "harpoon-report.yml"
+	callGraph          bool
+	maxDepth           int
+	jobs               int
+	buildTags          []string
+	buildFlags         []string
+	buildEnv           []string
+	goBin              string
+	reportFormat       string
+	coverageProfile    string
+	policyFile         string
 )
 
 // analyzeCmd represents the create args
 var analyzeCmd = &cobra.Command{
-	Use:   "analyze",
+	Use:   "analyze [packages]",
 	Short: "Analyze infers the symbols of functions that are tested by unit-tests",
 	Long: `
 `,
-	Example:       "  harpoon analyze --exclude vendor/",
+	Example: `  harpoon analyze --exclude vendor/
+  harpoon analyze ./pkg/...
+  harpoon analyze --from-coverage cover.out
+  harpoon analyze --policy harpoon-policy.yml
+  harpoon analyze --tags integration,netgo --build-flag='-ldflags=-s -w' --build-env CGO_ENABLED=0`,
 	SilenceUsage:  true,
 	SilenceErrors: true,
 	RunE: func(cmd *cobra.Command, args []string) error {
-		file, err := os.Open("go.mod")
+		modules, err := analyzer.FindModules(".")
 		if err != nil {
-			return fmt.Errorf("failed to open go.mod: %w", err)
+			return err
 		}
-		defer file.Close()
 
-		moduleName, err := analyzer.GetModuleName(file)
+		patterns := args
+		if len(patterns) == 0 {
+			patterns = []string{"./..."}
+		}
+		// each pattern goes to the module containing its packages,
+		// and the excluded modules are skipped before listing them.
+		matches, err := analyzer.MatchModules(".", modules, patterns)
+		if err != nil {
+			return err
+		}
+		matches, err = skipExcludedModules(matches)
 		if err != nil {
-			return fmt.Errorf("error module name not found in go.mod: %w", err)
+			return err
 		}
 
-		symbolsList := metadata.NewSymbolsList()
+		format := metadata.Format(reportFormat)
+		reportFile := analysisReportFile
+		switch format {
+		case metadata.FormatYAML:
+		case metadata.FormatJSON:
+			reportFile = strings.TrimSuffix(reportFile, filepath.Ext(reportFile)) + ".json"
+		default:
+			return fmt.Errorf("unknown report format %q (available formats: %s, %s)", reportFormat, metadata.FormatYAML, metadata.FormatJSON)
+		}
 
-		// walk the project file systems to find occurrences of _test.go files.
-		// when we find a _test.go file, we build the entire test of the package
-		// where we found the test.
-		// once built, we read the content of the test file to extract the symbols
-		// of the functions present in the binary.
-		// with all the collected symbols, we verify the presence of their associated function
-		// within the _test.go files in the same directory.
-		// if some function is found, then we add this to the final report.
-		err = filepath.Walk(".", func(path string, info os.FileInfo, err error) error {
+		for _, v := range buildEnv {
+			if !strings.Contains(v, "=") {
+				return fmt.Errorf("invalid build environment variable %q, expected KEY=VALUE", v)
+			}
+		}
+		// a relative path of the go binary is relative to the current directory,
+		// while the go tool runs from the module (or the package) directory.
+		if strings.ContainsRune(goBin, filepath.Separator) {
+			absGoBin, err := filepath.Abs(goBin)
 			if err != nil {
-				return fmt.Errorf("error walking filesystem: %v", err)
+				return fmt.Errorf("error resolving path of %s: %w", goBin, err)
 			}
+			goBin = absGoBin
+		}
+		buildOpts := executor.BuildOptions{
+			GoBin: goBin,
+			Tags:  buildTags,
+			Flags: buildFlags,
+			Env:   buildEnv,
+		}
 
-			if shouldSkipPath(path) {
-				if info.IsDir() {
-					return filepath.SkipDir
-				}
-				return nil
-			}
-			fmt.Printf("analyzing file: %s\n", path)
-
-			// we found a _test.go file, so we are going to build it
-			// and retrieve its symbols.
-			if !info.IsDir() && strings.HasSuffix(info.Name(), "_test.go") {
-				// build test binary
-				os.Mkdir(directory, 0644)
-
-				// converting pkg where we found tests
-				// to a test-bin-file name.
-				// eg. ./pkg/v1beta1/ -> __pkg_v1beta1.test
-				pkgPath := getPackagePath(path)
-				testBinFile := archiver.Convert(pkgPath)
-				testBinFile = testBinFile + ".test"
-				// this is where we are going to store out test-bin-file.
-				testBinPath := filepath.Join(directory, testBinFile)
-
-				fmt.Println("building test binary:", testBinFile)
-				_, err = executor.Build(pkgPath, testBinPath)
-				if err != nil {
-					return fmt.Errorf("failed to build test file: %v", err)
-				}
+		wd, err := os.Getwd()
+		if err != nil {
+			return fmt.Errorf("error getting working directory: %w", err)
+		}
+		symbolsList := metadata.NewSymbolsList()
+		// the relative paths of the report are relative to the current directory.
+		symbolsList.BaseDir = wd
+		// the build options are recorded, so that it's known
+		// how the traced test binaries were built.
+		buildInfo := &metadata.BuildInfo{
+			Go:    goBin,
+			Tags:  buildTags,
+			Flags: buildFlags,
+			Env:   buildEnv,
+		}
+		if !buildInfo.IsEmpty() {
+			symbolsList.Build = buildInfo
+		}
+		symbolPolicy := &policy.Policy{}
+		if policyFile != "" {
+			symbolPolicy, err = policy.Load(policyFile)
+			if err != nil {
+				return err
+			}
+		}
 
-				// retrieving function symbols from ELF file.
-				elf, err := elfreader.NewElfReader(testBinPath)
-				if err != nil {
-					return fmt.Errorf("failed to initialize elf file: %v", err)
-				}
-				fnSymbols, err := elf.FunctionSymbols(moduleName)
+		var profiles []*cover.Profile
+		if coverageProfile != "" {
+			profiles, err = loadCoverage(coverageProfile, matches, buildOpts)
+			if err != nil {
+				return err
+			}
+		}
+		for _, match := range matches {
+			module := match.Module
+			// with a coverage profile, the functions run by the tests
+			// are known, by their normalized symbol.
+			var covered map[string]coverage.Function
+			var untested []string
+			if profiles != nil {
+				functions, err := coverage.Functions(profiles, module.Path, module.Dir)
 				if err != nil {
-					return fmt.Errorf("failed to get function symbols: %v", err)
+					return err
 				}
-
-				symbolsOrig := metadata.NewSymbolsOrigin(testBinPath)
-
-				// for each symbol found in the ELF file,
-				// we are going to verify if the related function exists
-				// in the _test.go files in the same directory.
-				// if not, they will not be included in the report,
-				// so we can avoid useless symbols to be traced.
-				for _, symbol := range fnSymbols {
-					functionName := analyzer.ExtractFunctionName(symbol)
-					testFiles, _ := listTestFiles(path)
-					for _, testFile := range testFiles {
-						tf, err := os.Open(testFile)
-						if err != nil {
-							fmt.Printf("error opening file: %v\n", err)
-							continue
-						}
-						defer tf.Close()
-
-						exists, _ := analyzer.CheckFunctionExists(functionName, tf)
-						if exists {
-							//fmt.Printf("function %s exists in file %s\n", functionName, testFile)
-							symbolsOrig.Add(symbol)
-							break // this will save us some iterations
-						}
+				covered = make(map[string]coverage.Function)
+				for _, fn := range functions {
+					if fn.Covered {
+						covered[fn.String()] = fn
+					} else {
+						untested = append(untested, fn.String())
 					}
 				}
-				// if we've found symbols, then we add the list
-				// to the corresponding binary entry.
-				// eg:
-				// - testBinaryPath: /tmp/artifacts/__pkg_utils.test
-				//   symbols:
-				//   - github.com/myuser/myproject/pkg/utils.NewUserGroupList
-				//   - github.com/myuser/myproject/pkg/utils.(*userGroupList).Find
-				if !symbolsOrig.IsEmpty() {
-					symbolsList.Add(symbolsOrig)
-				}
-				return filepath.SkipDir
+				fmt.Printf("functions not run by the tests of %s: %d\n", module.Path, len(untested))
 			}
-			return nil
-		})
-
-		if err != nil {
-			fmt.Printf("error walking the path: %v\n", err)
+			origins, err := analyzeModule(module, match.Patterns, buildOpts, covered, symbolPolicy)
+			if err != nil {
+				return err
+			}
+			// a single module keeps the symbols at the top level,
+			// while each module of a workspace gets its own section.
+			if len(modules) == 1 {
+				symbolsList.SymbolsOrigins = origins
+				symbolsList.Untested = untested
+				break
+			}
+			symbolsList.AddModule(metadata.ModuleSymbols{
+				Path:           module.Path,
+				Dir:            module.Dir,
+				SymbolsOrigins: origins,
+				Untested:       untested,
+			})
 		}
 
 		// store to file
 		if saveAnalysis {
-			file, err = os.Create(analysisReportFile)
+			file, err := os.Create(reportFile)
 			if err != nil {
 				return fmt.Errorf("failed to create symbols list file: %w", err)
 			}
-			mw := io.Writer(file)
-			_, err := fmt.Fprintln(mw, symbolsList.String())
-			if err != nil {
-				return fmt.Errorf("error writing into %s: %v", analysisReportFile, err)
+			defer file.Close()
+			if err := symbolsList.Encode(file, format); err != nil {
+				return fmt.Errorf("error writing into %s: %v", reportFile, err)
 			}
-			fmt.Printf("file %s is ready\n", analysisReportFile)
+			fmt.Printf("file %s is ready\n", reportFile)
 		} else {
-			fmt.Println(symbolsList.String())
+			if err := symbolsList.Encode(os.Stdout, format); err != nil {
+				return err
+			}
 		}
 		return nil
 	},
@@ -181,60 +217,373 @@ func init() {
 	analyzeCmd.Flags().StringSliceVarP(&excludeList, "exclude", "e", []string{}, "Exclude directory from analysis")
 	analyzeCmd.Flags().BoolVarP(&saveAnalysis, "save", "S", false, "Save analysis result into a file")
 	analyzeCmd.Flags().StringVarP(&directory, "directory", "D", ".harpoon", "Store saved files in a directory")
+	analyzeCmd.Flags().StringVar(&reportFormat, "format", string(metadata.FormatYAML), "Format of the report (yaml, json)")
+	analyzeCmd.Flags().BoolVar(&callGraph, "call-graph", false, "Find the functions reachable from the tests through their call graph")
+	analyzeCmd.Flags().IntVarP(&jobs, "jobs", "j", runtime.NumCPU(), "Number of test binaries built in parallel")
+	analyzeCmd.Flags().StringSliceVar(&buildTags, "tags", []string{}, "Build tags of the test binaries (eg. integration,netgo)")
+	analyzeCmd.Flags().StringArrayVar(&buildFlags, "build-flag", []string{}, "Additional flag to build the test binaries with (eg. '-ldflags=-s -w')")
+	analyzeCmd.Flags().StringArrayVar(&buildEnv, "build-env", []string{}, "Environment variable (KEY=VALUE) of the go tool building the test binaries (eg. CGO_ENABLED=0)")
+	analyzeCmd.Flags().StringVar(&goBin, "go", "", "Path of the go binary building the test binaries (default go from the PATH)")
+	analyzeCmd.Flags().IntVar(&maxDepth, "max-depth", 0, "Max number of calls between a test and the functions found with --call-graph (0 means no limit)")
+	analyzeCmd.Flags().StringVar(&coverageProfile, "from-coverage", "", "Coverage profile (go test -coverprofile) telling the functions run by the tests, generated when missing")
+	analyzeCmd.MarkFlagsMutuallyExclusive("call-graph", "from-coverage")
+	analyzeCmd.Flags().StringVar(&policyFile, "policy", "", "File with the rules including and excluding the symbols, and their max number per test binary")
 }
 
-func shouldSkipPath(path string) bool {
-	for _, excludedPath := range excludeList {
-		if strings.Contains(path, excludedPath) {
-			return true
+// loadCoverage reads the coverage profile or, when missing,
+// generates it running the tests of the packages matched in each module.
+func loadCoverage(path string, matches []analyzer.ModulePatterns, buildOpts executor.BuildOptions) ([]*cover.Profile, error) {
+	if _, err := os.Stat(path); err == nil {
+		fmt.Println("using coverage profile:", path)
+		profiles, err := cover.ParseProfiles(path)
+		if err != nil {
+			return nil, fmt.Errorf("error reading coverage profile %s: %w", path, err)
 		}
+		return profiles, nil
 	}
-	return false
+
+	fmt.Println("generating coverage profile:", path)
+	var profiles []*cover.Profile
+	for _, match := range matches {
+		moduleProfiles, err := coverage.Generate(match.Dir, match.Patterns, buildOpts)
+		if errors.Is(err, coverage.ErrPartialProfile) {
+			fmt.Printf("warning: %v\n", err)
+		} else if err != nil {
+			return nil, err
+		}
+		profiles = append(profiles, moduleProfiles...)
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create coverage profile: %w", err)
+	}
+	defer file.Close()
+	if err := coverage.Write(file, profiles); err != nil {
+		return nil, fmt.Errorf("error writing into %s: %v", path, err)
+	}
+	return profiles, nil
 }
 
-func getPackagePath(inputPath string) string {
-	// Normalize the path
-	normalizedPath := filepath.Clean(inputPath)
+// analyzeModule returns the symbols of the module functions
+// tested by the packages matching the patterns (relative to the module).
+// With the covered functions, only the symbols of the functions
+// of each package run by its tests are kept.
+// The symbols are first selected by the policy, which limits their number as well.
+func analyzeModule(module analyzer.Module, patterns []string, buildOpts executor.BuildOptions, covered map[string]coverage.Function, symbolPolicy *policy.Policy) ([]metadata.SymbolsOrigin, error) {
+	// the functions reachable from the tests of each package.
+	var reachable map[string][]testgraph.Reach
+	if callGraph {
+		fmt.Println("building call graph")
+		reaches, err := testgraph.Analyze(testgraph.Options{
+			Dir:        module.Dir,
+			Patterns:   patterns,
+			Module:     module.Path,
+			MaxDepth:   maxDepth,
+			BuildFlags: buildOpts.BuildFlags(),
+			Env:        buildOpts.Environ(),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("error building call graph: %w", err)
+		}
+		reachable = make(map[string][]testgraph.Reach)
+		for _, reach := range reaches {
+			reachable[reach.TestPackage] = append(reachable[reach.TestPackage], reach)
+		}
+	}
+
+	var origins []metadata.SymbolsOrigin
+
+	// go list finds the packages with tests matching the patterns,
+	// honoring the build constraints.
+	// for each package, we build its test binary
+	// and extract the symbols of the functions present in the binary.
+	// with all the collected symbols, we verify the presence of their associated function
+	// within the _test.go files of the package.
+	// if some function is found, then we add this to the final report.
+	pkgs, err := analyzer.ListTestPackages(module.Dir, patterns, buildOpts)
+	if err != nil {
+		return nil, err
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		return nil, fmt.Errorf("error getting working directory: %w", err)
+	}
+	var binaries []testBinary
+	for _, pkg := range pkgs {
+		relDir, err := filepath.Rel(wd, pkg.Dir)
+		if err != nil {
+			return nil, fmt.Errorf("error resolving path of %s: %w", pkg.Dir, err)
+		}
+		if shouldSkipPath(relDir) {
+			continue
+		}
+
+		// converting pkg where we found tests
+		// to a test-bin-file name.
+		// eg. ./pkg/v1beta1/ -> __pkg_v1beta1.test
+		pkgPath := "./" + filepath.ToSlash(relDir)
+		testBinFile := archiver.Convert(pkgPath)
+		testBinFile = testBinFile + ".test"
+		// this is where we are going to store out test-bin-file.
+		binaries = append(binaries, testBinary{
+			pkg:  pkg,
+			dir:  relDir,
+			path: filepath.Join(directory, testBinFile),
+		})
+	}
+	if err := buildTestBinaries(module, binaries, buildOpts); err != nil {
+		return nil, err
+	}
+
+	for _, bin := range binaries {
+		pkg, testBinPath, fnSymbols := bin.pkg, bin.path, bin.symbols
+		symbolsOrig := metadata.NewSymbolsOrigin(testBinPath)
+		symbolsOrig.Package = pkg.ImportPath
+		fnSymbols, err = selectSymbols(symbolPolicy, fnSymbols, testBinPath)
+		if err != nil {
+			return nil, err
+		}
 
-	// Get the directory part of the path if it's a file path
-	dirPath := normalizedPath
-	if !strings.HasSuffix(inputPath, "/") {
-		dirPath = filepath.Dir(normalizedPath)
+		if callGraph {
+			// with the call graph, we keep the symbols
+			// of the functions reachable from the tests.
+			// the generic functions have a symbol per shape
+			// of their type arguments, all of them are kept.
+			bySymbol := make(map[string]testgraph.Reach)
+			for _, reach := range reachable[pkg.ImportPath] {
+				bySymbol[reach.Symbol] = reach
+			}
+			for _, symbol := range fnSymbols {
+				reach, ok := bySymbol[elfreader.ElideTypeArgs(symbol)]
+				if !ok {
+					continue
+				}
+				symbolsOrig.Add(symbol)
+				symbolsOrig.AddPath(symbol, reach.Path)
+				symbolsOrig.AddTests(symbol, reach.Tests)
+			}
+		} else {
+			// for each symbol found in the ELF file,
+			// we are going to verify if the related function exists
+			// in the _test.go files of the package
+			// (or, with the coverage profile, was run by its tests).
+			// if not, they will not be included in the report,
+			// so we can avoid useless symbols to be traced.
+			var symbols []string
+			if covered != nil {
+				symbols = coveredSymbols(fnSymbols, pkg.ImportPath, covered)
+			} else {
+				symbols = testedSymbols(fnSymbols, pkg.TestFiles())
+			}
+			for _, symbol := range symbols {
+				symbolsOrig.Add(symbol)
+			}
+		}
+		// if we've found symbols, then we add the list
+		// to the corresponding binary entry.
+		// eg:
+		// - testBinaryPath: /tmp/artifacts/__pkg_utils.test
+		//   package: github.com/myuser/myproject/pkg/utils
+		//   digest: sha256:5f1d...
+		//   tests:
+		//   - TestFind
+		//   symbols:
+		//   - github.com/myuser/myproject/pkg/utils.NewUserGroupList
+		//   - github.com/myuser/myproject/pkg/utils.(*userGroupList).Find
+		//   symbolTests:
+		//     github.com/myuser/myproject/pkg/utils.(*userGroupList).Find:
+		//     - TestFind
+		if removed := symbolsOrig.Limit(symbolPolicy.MaxSymbols); removed > 0 {
+			fmt.Printf("warning: skipping %d symbols of %s, over the limit of %d\n", removed, testBinPath, symbolPolicy.MaxSymbols)
+		}
+		if symbolsOrig.IsEmpty() {
+			continue
+		}
+		symbolsOrig.Tests, err = analyzer.TestFunctions(pkg.TestFiles())
+		if err != nil {
+			return nil, err
+		}
+		symbolsOrig.Dir = bin.dir
+		symbolsOrig.Digest, symbolsOrig.BuildID, err = testBinaryIdentity(testBinPath)
+		if err != nil {
+			return nil, err
+		}
+		symbolsOrig.InputsDigest = "sha256:" + bin.key
+		origins = append(origins, *symbolsOrig)
 	}
+	return origins, nil
+}
 
-	// Ensure the path starts with "./"
-	if !strings.HasPrefix(dirPath, ".") {
-		dirPath = "./" + dirPath
+// testBinary is the test binary of a package,
+// with the symbols of the module functions found in it.
+type testBinary struct {
+	pkg analyzer.Package
+	// dir is the directory of the package, relative to the current one.
+	dir     string
+	path    string
+	symbols []string
+	// key is the digest of the inputs of the binary.
+	key string
+}
+
+// buildTestBinaries builds the test binaries of the packages,
+// up to jobs at a time, and reads their function symbols.
+// The binaries (and their symbols) are taken from the cache
+// when their inputs, the build flags and the go toolchain didn't change.
+func buildTestBinaries(module analyzer.Module, binaries []testBinary, buildOpts executor.BuildOptions) error {
+	if jobs < 1 {
+		return fmt.Errorf("the number of jobs must be at least 1")
+	}
+	if err := os.MkdirAll(directory, 0755); err != nil {
+		return fmt.Errorf("error creating directory %s: %w", directory, err)
+	}
+	cache, err := buildcache.New(filepath.Join(directory, "cache"))
+	if err != nil {
+		return err
+	}
+	toolchain, err := buildcache.Toolchain(module.Dir, buildOpts)
+	if err != nil {
+		return err
 	}
 
-	// Remove any leading "../" or "./" parts not relevant to the target directory structure
-	// Adjust this according to your specific requirements
-	dirPath = strings.TrimPrefix(dirPath, "../")
-	dirPath = strings.TrimPrefix(dirPath, "./")
-	//dirPath = strings.TrimPrefix(inputPath, rootPath)
+	var g errgroup.Group
+	g.SetLimit(jobs)
+	for i := range binaries {
+		bin := &binaries[i]
+		g.Go(func() error {
+			fmt.Printf("analyzing package: %s\n", bin.pkg.ImportPath)
+			key, err := buildcache.Key(toolchain, buildOpts.TestFlags(), bin.pkg.Inputs)
+			if err != nil {
+				return err
+			}
+			bin.key = key
+			testBinFile := filepath.Base(bin.path)
+			if symbols, ok := cache.Symbols(key); ok {
+				fmt.Println("using cached test binary:", testBinFile)
+				bin.symbols = symbols
+				return cache.Link(key, bin.path)
+			}
 
-	// Add "./" at the start again if necessary
-	dirPath = "./" + dirPath
+			fmt.Println("building test binary:", testBinFile)
+			// the test binary is built from the module directory.
+			absBinPath, err := filepath.Abs(cache.BinaryPath(key))
+			if err != nil {
+				return fmt.Errorf("error resolving path of %s: %w", cache.BinaryPath(key), err)
+			}
+			_, err = executor.Build(module.Dir, bin.pkg.Dir, absBinPath, buildOpts)
+			if err != nil {
+				return fmt.Errorf("failed to build test file: %v", err)
+			}
 
-	return dirPath
+			// retrieving function symbols from ELF file.
+			elf, err := elfreader.NewElfReader(absBinPath)
+			if err != nil {
+				return fmt.Errorf("failed to initialize elf file: %v", err)
+			}
+			bin.symbols, err = elf.FunctionSymbols(module.Path)
+			elf.Close()
+			if err != nil {
+				return fmt.Errorf("failed to get function symbols: %v", err)
+			}
+			if err := cache.SaveSymbols(key, bin.symbols); err != nil {
+				return err
+			}
+			return cache.Link(key, bin.path)
+		})
+	}
+	return g.Wait()
 }
 
-// listTestFiles lists all files in the directory that end with "_test.go".
-func listTestFiles(directory string) ([]string, error) {
-	var testFiles []string
+// skipExcludedModules returns the matched modules
+// whose directory is not excluded.
+func skipExcludedModules(matches []analyzer.ModulePatterns) ([]analyzer.ModulePatterns, error) {
+	wd, err := os.Getwd()
+	if err != nil {
+		return nil, fmt.Errorf("error getting working directory: %w", err)
+	}
+	var kept []analyzer.ModulePatterns
+	for _, match := range matches {
+		absDir, err := filepath.Abs(match.Dir)
+		if err != nil {
+			return nil, fmt.Errorf("error resolving path of %s: %w", match.Dir, err)
+		}
+		relDir, err := filepath.Rel(wd, absDir)
+		if err != nil {
+			return nil, fmt.Errorf("error resolving path of %s: %w", match.Dir, err)
+		}
+		if shouldSkipPath(relDir) {
+			fmt.Printf("skipping excluded module: %s\n", match.Path)
+			continue
+		}
+		kept = append(kept, match)
+	}
+	return kept, nil
+}
+
+// shouldSkipPath returns true if the directory (relative to the current one)
+// is excluded, or is within an excluded directory.
+// The excluded directories can be written as ./vendor, vendor/ or ./vendor/...
+func shouldSkipPath(dir string) bool {
+	dir = filepath.ToSlash(filepath.Clean(dir))
+	for _, excludedPath := range excludeList {
+		excluded := strings.TrimSuffix(filepath.ToSlash(excludedPath), "...")
+		excluded = filepath.ToSlash(filepath.Clean(excluded))
+		if dir == excluded || strings.HasPrefix(dir, excluded+"/") {
+			return true
+		}
+	}
+	return false
+}
 
-	// Walk through the directory
-	err := filepath.Walk(directory, func(path string, info os.FileInfo, err error) error {
+// selectSymbols returns the symbols of the test binary selected by the policy.
+func selectSymbols(symbolPolicy *policy.Policy, fnSymbols []string, testBinPath string) ([]string, error) {
+	var files map[string]string
+	if symbolPolicy.UsesFiles() {
+		elf, err := elfreader.NewElfReader(testBinPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to initialize elf file: %v", err)
+		}
+		files, err = elf.SymbolFiles(fnSymbols)
+		elf.Close()
 		if err != nil {
-			return err // Handle errors while walking
+			return nil, fmt.Errorf("failed to get source files of %s: %v", testBinPath, err)
 		}
+	}
+	return symbolPolicy.Select(fnSymbols, files), nil
+}
 
-		// Check if the file ends with "_test.go"
-		if !info.IsDir() && strings.HasSuffix(info.Name(), "_test.go") {
-			testFiles = append(testFiles, path)
+// coveredSymbols returns the symbols of the covered functions
+// declared in the package.
+func coveredSymbols(fnSymbols []string, pkgPath string, covered map[string]coverage.Function) []string {
+	var tested []string
+	for _, symbol := range fnSymbols {
+		fn, ok := covered[coverage.Normalize(symbol)]
+		if ok && fn.Package == pkgPath {
+			tested = append(tested, symbol)
 		}
-		return nil
-	})
+	}
+	return tested
+}
 
-	return testFiles, err
+// testedSymbols returns the symbols whose function
+// is called within the test files.
+func testedSymbols(fnSymbols, testFiles []string) []string {
+	var tested []string
+	for _, symbol := range fnSymbols {
+		functionName := analyzer.ExtractFunctionName(symbol)
+		for _, testFile := range testFiles {
+			tf, err := os.Open(testFile)
+			if err != nil {
+				fmt.Printf("error opening file: %v\n", err)
+				continue
+			}
+			exists, _ := analyzer.CheckFunctionExists(functionName, tf)
+			tf.Close()
+			if exists {
+				tested = append(tested, symbol)
+				break // this will save us some iterations
+			}
+		}
+	}
+	return tested
 }
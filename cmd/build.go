@@ -17,14 +17,19 @@ package cmd
 
 import (
 	"bufio"
+	"errors"
 	"fmt"
+	"io/fs"
 	"os"
 	"path/filepath"
 	"slices"
 	"sort"
+	"strings"
 
 	seccomp "github.com/alegrey91/harpoon/internal/seccomputils"
+	"github.com/alegrey91/harpoon/internal/stability"
 	"github.com/alegrey91/harpoon/internal/syscallutils"
+	"github.com/alegrey91/harpoon/internal/testmap"
 	"github.com/spf13/cobra"
 )
 
@@ -39,6 +44,7 @@ var (
 	dockerEnv           = "docker"
 	expectedSyscallSets = []string{dynamicBin, staticBin, dockerEnv}
 	architectures       = []string{"SCMP_ARCH_X86_64", "SCMP_ARCH_X86", "SCMP_ARCH_X32"}
+	minRatio            float64
 )
 
 // buildCmd represents the create args
@@ -51,6 +57,9 @@ var buildCmd = &cobra.Command{
 	SilenceUsage:  true,
 	SilenceErrors: true,
 	PreRunE: func(cmd *cobra.Command, args []string) error {
+		if minRatio < 0 || minRatio > 1 {
+			return fmt.Errorf("invalid minimum ratio %v, expected a value between 0 and 1", minRatio)
+		}
 		// validate syscall sets have expected values
 		if cmd.Flags().Changed("add-syscall-sets") {
 			return validateSyscallSets(syscallSets, expectedSyscallSets)
@@ -58,7 +67,19 @@ var buildCmd = &cobra.Command{
 		return nil
 	},
 	RunE: func(cmd *cobra.Command, args []string) error {
-		files, err := os.ReadDir(inputDirectory)
+		// the results of the env matrix variants are stored
+		// in sub directories, so they are merged as well.
+		var files []string
+		err := filepath.WalkDir(inputDirectory, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			// the stats and tests are read along with their metadata file.
+			if !d.IsDir() && !strings.HasSuffix(path, stability.FileSuffix) && !strings.HasSuffix(path, testmap.FileSuffix) {
+				files = append(files, path)
+			}
+			return nil
+		})
 		if err != nil {
 			return fmt.Errorf("error reading dir content: %w", err)
 		}
@@ -90,20 +111,35 @@ var buildCmd = &cobra.Command{
 		}
 
 		syscalls := make([]string, 0)
+		var ioUringOps []string
 		// collect syscalls from files
-		for _, fileObj := range files {
-			file, err := os.Open(filepath.Join(inputDirectory, fileObj.Name()))
+		for _, fileName := range files {
+			file, err := os.Open(fileName)
 			if err != nil {
-				return fmt.Errorf("error opening file %q: %w", fileObj.Name(), err)
+				return fmt.Errorf("error opening file %q: %w", fileName, err)
 			}
 			defer file.Close()
 
+			stats, err := loadStats(fileName)
+			if err != nil {
+				return err
+			}
+
 			scanner := bufio.NewScanner(file)
 			for scanner.Scan() {
 				syscall := scanner.Text()
+				if op, found := strings.CutPrefix(syscall, syscallutils.IOUringOpPrefix); found {
+					if !slices.Contains(ioUringOps, op) {
+						ioUringOps = append(ioUringOps, op)
+					}
+					continue
+				}
 				if !seccomp.IsValidSyscall(syscall) {
 					continue
 				}
+				if !stableEnough(stats, syscall) {
+					continue
+				}
 				if syscallVariants {
 					variants := syscallutils.GetVariants(syscall)
 					if len(variants) > 0 {
@@ -126,6 +162,8 @@ var buildCmd = &cobra.Command{
 		}
 		sort.Strings(syscalls)
 
+		warnIOUring(syscalls, ioUringOps)
+
 		profile, err := seccomp.BuildProfile(syscalls, architectures)
 		if err != nil {
 			return fmt.Errorf("error building seccomp profile: %w", err)
@@ -162,6 +200,47 @@ func init() {
 	buildCmd.Flags().BoolVarP(&saveProfile, "save", "S", false, "save profile to a file")
 	buildCmd.Flags().StringVarP(&profileName, "name", "n", profileName, "specify a name for the seccomp profile")
 	buildCmd.Flags().StringSliceVarP(&architectures, "archs", "a", architectures, "profile architectures to be used for system calls")
+	buildCmd.Flags().Float64Var(&minRatio, "min-ratio", 0, "minimum ratio of runs a system call must appear in (requires files captured with --runs)")
+}
+
+// loadStats returns the stats of the runs saved next to the metadata file.
+// Returns nil if the file was captured with a single run,
+// or if no minimum ratio is required.
+func loadStats(fileName string) (*stability.Stats, error) {
+	if minRatio == 0 {
+		return nil, nil
+	}
+	stats, err := stability.Load(fileName + stability.FileSuffix)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	return stats, err
+}
+
+// stableEnough returns true if the syscall appeared in enough runs.
+// Syscalls without stats are always kept.
+func stableEnough(stats *stability.Stats, syscall string) bool {
+	if stats == nil {
+		return true
+	}
+	ratio, ok := stats.Ratio(syscall)
+	return !ok || ratio >= minRatio
+}
+
+// warnIOUring warns about the usage of io_uring,
+// since its operations are not restricted by the seccomp profile.
+func warnIOUring(syscalls, ioUringOps []string) {
+	used := slices.Clone(ioUringOps)
+	sort.Strings(used)
+	for _, syscall := range syscallutils.IOUringSyscalls {
+		if slices.Contains(syscalls, syscall) {
+			used = append(used, syscall)
+		}
+	}
+	if len(used) == 0 {
+		return
+	}
+	fmt.Fprintf(os.Stderr, "warning: io_uring is used (%s), the seccomp profile doesn't restrict the operations submitted through it\n", strings.Join(used, ", "))
 }
 
 // validateSyscallsSets ensure all the passed values are correct
@@ -17,9 +17,24 @@ package cmd
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"slices"
+	"strings"
+	"syscall"
+	"time"
 
+	"github.com/alegrey91/harpoon/internal/container"
 	"github.com/alegrey91/harpoon/internal/ebpf/probesfacade/captor"
+	"github.com/alegrey91/harpoon/internal/envmatrix"
+	"github.com/alegrey91/harpoon/internal/executor"
+	"github.com/alegrey91/harpoon/internal/recorder"
+	seccomp "github.com/alegrey91/harpoon/internal/seccomputils"
+	"github.com/alegrey91/harpoon/internal/stability"
+	"github.com/alegrey91/harpoon/internal/testmap"
 	"github.com/alegrey91/harpoon/internal/writer"
 	"github.com/spf13/cobra"
 )
@@ -33,6 +48,23 @@ var save bool
 var directory string
 var filename string
 var dumpInterval int
+var recordFile string
+var cgroupPath string
+var containerID string
+var attachPID int
+var followGoroutines bool
+var captureDuration time.Duration
+var commandStdin bool
+var commandStdoutFile string
+var commandStderrFile string
+var propagateExitCode bool
+var runAsUser string
+var runAsGroup string
+var workDir string
+var cleanEnv bool
+var envFile string
+var envMatrixFile string
+var captureRuns int
 
 // captureCmd represents the create args
 var captureCmd = &cobra.Command{
@@ -41,15 +73,58 @@ var captureCmd = &cobra.Command{
 	Long: `Capture gives you the ability of tracing system calls
 by passing the function name symbol and the binary args.
 `,
-	Example:       "  harpoon -f main.doSomething -- ./command arg1 arg2 ...",
+	Example: `  harpoon -f main.doSomething -- ./command arg1 arg2 ...
+  harpoon capture -f main.doSomething --container-id 4f2a9c1b7e3d -- /app/command`,
 	SilenceUsage:  true,
 	SilenceErrors: true,
 	RunE: func(cmd *cobra.Command, args []string) error {
 		opts := captor.CaptureOptions{
-			CommandOutput: commandOutput,
-			CommandError:  commandError,
-			LibbpfOutput:  libbpfOutput,
-			Interval:      dumpInterval,
+			CommandOutput:    commandOutput,
+			CommandError:     commandError,
+			LibbpfOutput:     libbpfOutput,
+			Interval:         dumpInterval,
+			CgroupPath:       cgroupPath,
+			AttachPID:        attachPID,
+			FollowGoroutines: followGoroutines,
+			Stdin:            commandStdin,
+			StdoutFile:       commandStdoutFile,
+			StderrFile:       commandStderrFile,
+		}
+		env, err := setupCommand(&opts)
+		if err != nil {
+			return err
+		}
+
+		if containerID != "" {
+			path, err := container.FindCgroup(container.CgroupRoot, containerID)
+			if err != nil {
+				return fmt.Errorf("error looking for container: %w", err)
+			}
+			opts.CgroupPath = path
+		}
+
+		// containers are already running, as well as the processes
+		// of a cgroup provided without any command, so we attach to them.
+		// in this case, the argument (if any) is the path of the binary
+		// within the mount namespace of the process.
+		if opts.CgroupPath != "" && opts.AttachPID == 0 && (containerID != "" || len(args) == 0) {
+			pids, err := container.CgroupProcs(opts.CgroupPath)
+			if err != nil {
+				return fmt.Errorf("error getting processes of cgroup: %w", err)
+			}
+			if len(pids) == 0 {
+				return fmt.Errorf("no processes found in cgroup %s", opts.CgroupPath)
+			}
+			opts.AttachPID = pids[0]
+		}
+
+		if recordFile != "" {
+			rec, err := recorder.Create(recordFile)
+			if err != nil {
+				return fmt.Errorf("error setting up recording: %w", err)
+			}
+			defer rec.Close()
+			opts.Recorder = rec
 		}
 
 		saveOpts := writer.WriteOptions{
@@ -58,36 +133,48 @@ by passing the function name symbol and the binary args.
 			Directory: directory,
 		}
 
-		for _, functionSymbol := range functionSymbols {
-			resultCh := make(chan []uint32)
-			errorCh := make(chan error)
-			ctx := context.Background()
+		// on SIGINT/SIGTERM the command is stopped,
+		// and the syscalls collected so far are written.
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		if captureDuration > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, captureDuration)
+			defer cancel()
+		}
 
-			ebpf, err := captor.InitProbes(functionSymbol, args, envVars, opts)
-			if err != nil {
-				return fmt.Errorf("error setting up ebpf module: %w", err)
-			}
-			defer ebpf.Close()
-
-			// this will get incremental results
-			go func() {
-				ebpf.Capture(ctx, resultCh, errorCh)
-			}()
-
-			for {
-				select {
-				case syscalls := <-resultCh:
-					if err := writer.Write(syscalls, functionSymbol, saveOpts); err != nil {
-						return fmt.Errorf("error writing syscalls for symbol %s: %w", functionSymbol, err)
-					}
-				case err := <-errorCh:
-					if err != nil {
-						return fmt.Errorf("error: %w", err)
-					}
-					return nil
+		variants, err := loadVariants()
+		if err != nil {
+			return err
+		}
+		if len(variants) > 1 && opts.AttachPID > 0 {
+			return fmt.Errorf("the env matrix can't be used when attaching to a running process")
+		}
+
+		// the command is executed once per symbol (and variant),
+		// the first failure determines the exit status.
+		status := 0
+		for _, variant := range variants {
+			for _, functionSymbol := range functionSymbols {
+				if ctx.Err() != nil {
+					break
+				}
+				printVariant(variant)
+				variantOpts := variantSaveOpts(saveOpts, variant)
+				code, err := repeatCapture(ctx, functionSymbol, captureRuns, variantOpts, func(run int) (traceResult, error) {
+					return runCapture(ctx, functionSymbol, args, variantEnv(env, variant), runOptions(opts, variant, run), variantOpts)
+				})
+				if err != nil {
+					return err
+				}
+				if status == 0 {
+					status = code
 				}
 			}
 		}
+		if propagateExitCode && status != 0 {
+			return &exitCodeError{code: status}
+		}
 		return nil
 	},
 }
@@ -101,11 +188,278 @@ func init() {
 
 	captureCmd.Flags().BoolVarP(&commandOutput, "include-cmd-stdout", "c", false, "Include the executed command output")
 	captureCmd.Flags().BoolVarP(&commandError, "include-cmd-stderr", "e", false, "Include the executed command error")
+	captureCmd.Flags().StringVar(&envFile, "env-file", "", "File with the environment variables (KEY=VALUE) to be passed to the executed command")
+	captureCmd.Flags().IntVar(&captureRuns, "runs", 1, "Number of times the command is executed, to find the flaky system calls")
+	captureCmd.Flags().StringVar(&envMatrixFile, "env-matrix", "", "File with the environment variants the command is executed with, one at a time")
+	captureCmd.Flags().BoolVar(&cleanEnv, "clean-env", false, "Don't pass the harpoon environment to the executed command")
+	captureCmd.Flags().StringVarP(&runAsUser, "user", "u", "", "Execute the command as the given user (default $SUDO_UID)")
+	captureCmd.Flags().StringVar(&runAsGroup, "group", "", "Execute the command as the given group (default $SUDO_GID)")
+	captureCmd.Flags().StringVarP(&workDir, "workdir", "w", "", "Working directory of the executed command")
+	captureCmd.Flags().BoolVar(&commandStdin, "stdin", false, "Connect stdin to the executed command")
+	captureCmd.Flags().StringVar(&commandStdoutFile, "cmd-stdout-file", "", "Write the raw output of the executed command to a file (- for stdout)")
+	captureCmd.Flags().StringVar(&commandStderrFile, "cmd-stderr-file", "", "Write the raw error of the executed command to a file (- for stderr)")
+	captureCmd.Flags().BoolVar(&propagateExitCode, "exit-code", false, "Exit with the status of the executed command")
+	captureCmd.Flags().BoolVarP(&followGoroutines, "follow-goroutines", "g", false, "Charge to the traced function the syscalls of the goroutines it spawns")
 	captureCmd.Flags().BoolVarP(&libbpfOutput, "include-libbpf-output", "l", false, "Include the libbpf output")
 
 	captureCmd.Flags().BoolVarP(&save, "save", "S", false, "Save output to a file")
 	captureCmd.Flags().StringVarP(&filename, "name", "n", "", "Specify a name for the saved output")
 	captureCmd.Flags().StringVarP(&directory, "directory", "D", "", "Store saved files in a directory")
 	captureCmd.Flags().IntVarP(&dumpInterval, "dump-interval", "i", 0, "Dump results every interval of time")
+	captureCmd.Flags().DurationVarP(&captureDuration, "duration", "d", 0, "Stop the capture after the given duration (eg. 30s, 5m)")
 	captureCmd.MarkFlagsRequiredTogether("save", "directory")
+	captureCmd.Flags().StringVarP(&recordFile, "record", "r", "", "Record the raw event stream into a file, to be processed later with replay")
+
+	captureCmd.Flags().StringVar(&cgroupPath, "cgroup", "", "Trace the processes of the given cgroup (v2) instead of filtering by command name")
+	captureCmd.Flags().StringVar(&containerID, "container-id", "", "Trace the processes of the given container")
+	captureCmd.Flags().IntVarP(&attachPID, "pid", "p", 0, "Attach to a running process instead of executing the command")
+	captureCmd.MarkFlagsMutuallyExclusive("cgroup", "container-id")
+}
+
+// setupCommand sets the options to execute the command,
+// so that it runs as the unprivileged user.
+// Returns the env variables of the command: those of the env file,
+// followed by the ones passed by flag.
+func setupCommand(opts *captor.CaptureOptions) ([]string, error) {
+	cred, err := executor.LookupCredential(runAsUser, runAsGroup)
+	if err != nil {
+		return nil, fmt.Errorf("error setting up command credentials: %w", err)
+	}
+	opts.Credential = cred
+	opts.Dir = workDir
+	opts.CleanEnv = cleanEnv
+
+	var env []string
+	if envFile != "" {
+		env, err = executor.ReadEnvFile(envFile)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return append(env, envVars...), nil
+}
+
+// loadVariants returns the variants of the env matrix.
+// Without a matrix, a single unnamed variant is returned,
+// so that the command is executed once as usual.
+func loadVariants() ([]envmatrix.Variant, error) {
+	if envMatrixFile == "" {
+		return []envmatrix.Variant{{}}, nil
+	}
+	matrix, err := envmatrix.Load(envMatrixFile)
+	if err != nil {
+		return nil, err
+	}
+	return matrix.Variants, nil
+}
+
+// printVariant prints the variant the command is executed with.
+func printVariant(variant envmatrix.Variant) {
+	if variant.Name != "" {
+		fmt.Printf("variant: %s\n", variant.Name)
+	}
+}
+
+// variantEnv returns the env variables of the command with the variant ones,
+// which take precedence.
+func variantEnv(env []string, variant envmatrix.Variant) []string {
+	return append(slices.Clone(env), variant.Env...)
+}
+
+// variantSaveOpts stores the results of the variant
+// in a dedicated sub directory.
+func variantSaveOpts(saveOpts writer.WriteOptions, variant envmatrix.Variant) writer.WriteOptions {
+	if variant.Name != "" {
+		saveOpts.Directory = filepath.Join(saveOpts.Directory, variant.Name)
+	}
+	return saveOpts
+}
+
+// runOptions returns the options of the given run of the command
+// with the variant, so that they are set in the recorded events.
+func runOptions(opts captor.CaptureOptions, variant envmatrix.Variant, run int) captor.CaptureOptions {
+	opts.Variant = variant.Name
+	opts.Run = run
+	return opts
+}
+
+// runCapture traces the function symbol during the execution of the command,
+// writing the results as soon as they are available.
+func runCapture(ctx context.Context, functionSymbol string, args, env []string, opts captor.CaptureOptions, saveOpts writer.WriteOptions) (traceResult, error) {
+	result, err := traceSymbol(ctx, functionSymbol, args, env, opts, func(syscalls []uint32) error {
+		if err := writer.Write(syscalls, functionSymbol, saveOpts); err != nil {
+			return fmt.Errorf("error writing syscalls for symbol %s: %w", functionSymbol, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return result, err
+	}
+	return result, writeTraceResult(functionSymbol, result, opts.PerTest, saveOpts)
+}
+
+// writeTraceResult writes the io_uring operations of the result,
+// and the syscalls of each test when attributing them to the tests.
+// The syscalls are written as soon as they are captured.
+func writeTraceResult(functionSymbol string, result traceResult, perTest bool, saveOpts writer.WriteOptions) error {
+	// io_uring operations are executed by the kernel
+	// without passing through the syscalls, so seccomp
+	// can't restrict them.
+	if ops := result.ioUringOps; len(ops) > 0 {
+		fmt.Fprintf(os.Stderr, "warning: %s submitted io_uring operations not restricted by seccomp: %s\n", functionSymbol, strings.Join(ops, ", "))
+		if err := writer.WriteIOUringOps(ops, functionSymbol, saveOpts); err != nil {
+			return fmt.Errorf("error writing io_uring operations for symbol %s: %w", functionSymbol, err)
+		}
+	}
+
+	if perTest {
+		if err := writer.WriteTests(result.tests, functionSymbol, saveOpts); err != nil {
+			return fmt.Errorf("error writing tests for symbol %s: %w", functionSymbol, err)
+		}
+	}
+	return nil
+}
+
+// repeatCapture runs the capture of the function symbol the given
+// number of times (see --runs), keeping the union of the syscalls.
+// With more than one run, the syscalls which didn't appear in every run
+// are reported as flaky, and the stats are saved next to the results.
+// Returns the exit status of the first failed run.
+// The runs are numbered from 1.
+func repeatCapture(ctx context.Context, functionSymbol string, runs int, saveOpts writer.WriteOptions, capture func(run int) (traceResult, error)) (int, error) {
+	status := 0
+	stats := stability.NewStats()
+	for i := 0; i < runs && ctx.Err() == nil; i++ {
+		if runs > 1 {
+			fmt.Printf("run: %d/%d\n", i+1, runs)
+		}
+		result, err := capture(i + 1)
+		if err != nil {
+			return status, err
+		}
+		if status == 0 {
+			status = result.exitCode
+		}
+		names, err := seccomp.Names(result.syscalls)
+		if err != nil {
+			return status, err
+		}
+		stats.AddRun(names)
+	}
+	if runs < 2 {
+		return status, nil
+	}
+
+	if flaky := stats.Flaky(); len(flaky) > 0 {
+		var counts []string
+		for _, syscall := range flaky {
+			counts = append(counts, fmt.Sprintf("%s (%d/%d)", syscall, stats.Syscalls[syscall], stats.Runs))
+		}
+		fmt.Fprintf(os.Stderr, "warning: %s has flaky system calls: %s\n", functionSymbol, strings.Join(counts, ", "))
+	}
+	if err := writer.WriteStats(stats, functionSymbol, saveOpts); err != nil {
+		return status, fmt.Errorf("error writing stats for symbol %s: %w", functionSymbol, err)
+	}
+	return status, nil
+}
+
+// traceResult holds the outcome of the capture of a symbol.
+type traceResult struct {
+	// syscalls is the union of the syscalls captured.
+	syscalls   []uint32
+	ioUringOps []string
+	// tests holds the syscalls made by each test, when attributing them.
+	tests    testmap.Tests
+	exitCode int
+}
+
+// traceSymbol traces the function symbol during the execution of the command,
+// passing the syscalls to handle as soon as they are available.
+func traceSymbol(ctx context.Context, functionSymbol string, args, env []string, opts captor.CaptureOptions, handle func(syscalls []uint32) error) (traceResult, error) {
+	var result traceResult
+	resultCh := make(chan []uint32)
+	errorCh := make(chan error)
+
+	ebpf, err := captor.InitProbes(functionSymbol, args, env, opts)
+	if err != nil {
+		return result, fmt.Errorf("error setting up ebpf module: %w", err)
+	}
+	defer ebpf.Close()
+
+	// the capture is cancelled when its results cannot be handled.
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// this will get incremental results
+	go func() {
+		ebpf.Capture(ctx, resultCh, errorCh)
+	}()
+
+	// on SIGUSR1 the syscalls collected so far are written immediately.
+	flushCh := make(chan os.Signal, 1)
+	signal.Notify(flushCh, syscall.SIGUSR1)
+	defer signal.Stop(flushCh)
+	captureDone := make(chan struct{})
+	defer close(captureDone)
+	go func() {
+		for {
+			select {
+			case <-flushCh:
+				ebpf.Flush()
+			case <-captureDone:
+				return
+			}
+		}
+	}()
+
+	// the channel is closed once the capture is completed.
+	for syscalls := range resultCh {
+		for _, id := range syscalls {
+			if !slices.Contains(result.syscalls, id) {
+				result.syscalls = append(result.syscalls, id)
+			}
+		}
+		if err := handle(syscalls); err != nil {
+			// the capture must be completed
+			// before closing the ebpf module.
+			cancel()
+			for range resultCh {
+			}
+			return result, err
+		}
+	}
+	if err := <-errorCh; err != nil {
+		return result, fmt.Errorf("error capturing: %w", err)
+	}
+	result.ioUringOps = ebpf.IOUringOps()
+	if opts.PerTest {
+		result.tests = make(testmap.Tests)
+		for test, syscalls := range ebpf.TestSyscalls() {
+			names, err := seccomp.Names(syscalls)
+			if err != nil {
+				return result, err
+			}
+			result.tests.Add(test, names)
+		}
+	}
+
+	// the command is not ours when attaching to a process.
+	if opts.AttachPID > 0 {
+		return result, nil
+	}
+	result.exitCode = commandExitCode(ebpf.CommandErr())
+	if result.exitCode != 0 {
+		fmt.Fprintf(os.Stderr, "command exited with status %d\n", result.exitCode)
+	}
+	return result, nil
+}
+
+// commandExitCode returns the exit code of the command,
+// printing the error in case it could not be started.
+func commandExitCode(err error) int {
+	var startErr *executor.StartError
+	if errors.As(err, &startErr) {
+		fmt.Fprintf(os.Stderr, "command execution error: %v\n", startErr)
+	}
+	return executor.ExitCode(err)
 }
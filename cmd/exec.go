@@ -0,0 +1,163 @@
+/*
+Copyright © 2024 Alessio Greggi
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+
+	"github.com/alegrey91/harpoon/internal/analyzer"
+	"github.com/alegrey91/harpoon/internal/ebpf/probesfacade/captor"
+	"github.com/alegrey91/harpoon/internal/elfreader"
+	"github.com/alegrey91/harpoon/internal/executor"
+	"github.com/alegrey91/harpoon/internal/writer"
+	"github.com/spf13/cobra"
+)
+
+var execDirectory string
+var execModule string
+
+// execCmd represents the exec command
+var execCmd = &cobra.Command{
+	Use:   "exec",
+	Short: "Exec traces the test binaries executed by go test",
+	Long: `Exec is meant to be used as the -exec program of go test.
+It receives the test binary built by the go tool, finds the functions
+of the module called by its tests, and captures their system calls
+while the tests run. The test binary is executed once per function:
+the output and the exit status of the first execution are passed back
+to go test. The results are saved in the directory of the module.
+`,
+	Example:       `  sudo go test -exec 'harpoon exec --' ./...`,
+	Args:          cobra.MinimumNArgs(1),
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		// go test executes the test binaries
+		// within the directory of their package.
+		goMod, err := analyzer.FindGoMod(".")
+		if err != nil {
+			return err
+		}
+		moduleName := execModule
+		if moduleName == "" {
+			file, err := os.Open(goMod)
+			if err != nil {
+				return fmt.Errorf("failed to open go.mod: %w", err)
+			}
+			moduleName, err = analyzer.GetModuleName(file)
+			file.Close()
+			if err != nil {
+				return fmt.Errorf("error module name not found in go.mod: %w", err)
+			}
+		}
+		resultsDir := execDirectory
+		if !filepath.IsAbs(resultsDir) {
+			resultsDir = filepath.Join(filepath.Dir(goMod), resultsDir)
+		}
+
+		elf, err := elfreader.NewElfReader(args[0])
+		if err != nil {
+			return fmt.Errorf("failed to initialize elf file: %w", err)
+		}
+		fnSymbols, err := elf.FunctionSymbols(moduleName)
+		elf.Close()
+		if err != nil {
+			return fmt.Errorf("failed to get function symbols: %w", err)
+		}
+		testFiles, err := filepath.Glob("*_test.go")
+		if err != nil {
+			return fmt.Errorf("error listing test files: %w", err)
+		}
+		symbols := testedSymbols(fnSymbols, testFiles)
+
+		opts := captor.CaptureOptions{
+			LibbpfOutput:     libbpfOutput,
+			FollowGoroutines: followGoroutines,
+			PerTest:          perTest,
+		}
+		env, err := setupCommand(&opts)
+		if err != nil {
+			return err
+		}
+		saveOpts := writer.WriteOptions{
+			Save:      true,
+			Directory: resultsDir,
+		}
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+
+		// nothing to trace, the test binary is just executed.
+		if len(symbols) == 0 {
+			runOpts := executor.RunOptions{
+				Env:        env,
+				Stdin:      true,
+				StdoutFile: "-",
+				StderrFile: "-",
+				Credential: opts.Credential,
+			}
+			if code := commandExitCode(executor.Run(ctx, args, runOpts, nil, nil)); code != 0 {
+				return &exitCodeError{code: code}
+			}
+			return nil
+		}
+
+		status := 0
+		for i, functionSymbol := range symbols {
+			if ctx.Err() != nil {
+				break
+			}
+			runOpts := opts
+			// go test reads the output of the first execution only,
+			// the following ones are silenced.
+			if i == 0 {
+				runOpts.Stdin = true
+				runOpts.StdoutFile = "-"
+				runOpts.StderrFile = "-"
+			}
+			result, err := runCapture(ctx, functionSymbol, args, env, runOpts, saveOpts)
+			if err != nil {
+				return err
+			}
+			if status == 0 {
+				status = result.exitCode
+			}
+		}
+		if status != 0 {
+			return &exitCodeError{code: status}
+		}
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(execCmd)
+
+	execCmd.Flags().StringVarP(&execDirectory, "directory", "D", "harpoon", "Store saved files in a directory (relative to the module)")
+	execCmd.Flags().StringVar(&execModule, "module", "", "Module of the functions to be traced (default from go.mod)")
+	execCmd.Flags().StringSliceVarP(&envVars, "env-var", "E", []string{}, "Environment variable to be passed to the test binaries")
+	execCmd.Flags().StringVarP(&runAsUser, "user", "u", "", "Execute the test binaries as the given user (default $SUDO_UID)")
+	execCmd.Flags().StringVar(&runAsGroup, "group", "", "Execute the test binaries as the given group (default $SUDO_GID)")
+
+	execCmd.Flags().BoolVarP(&followGoroutines, "follow-goroutines", "g", false, "Charge to the traced function the syscalls of the goroutines it spawns")
+	execCmd.Flags().BoolVar(&perTest, "per-test", false, "Attribute the system calls to the tests (and subtests) making them")
+	execCmd.Flags().BoolVarP(&libbpfOutput, "include-libbpf-output", "l", false, "Include the libbpf output")
+}
@@ -18,18 +18,27 @@ package cmd
 import (
 	"context"
 	"fmt"
-	"io"
 	"os"
+	"os/signal"
+	"regexp"
+	"slices"
+	"strings"
+	"syscall"
 
 	"github.com/alegrey91/harpoon/internal/ebpf/probesfacade/captor"
 	meta "github.com/alegrey91/harpoon/internal/metadata"
+	"github.com/alegrey91/harpoon/internal/recorder"
+	"github.com/alegrey91/harpoon/internal/sandbox"
 	"github.com/alegrey91/harpoon/internal/writer"
 	"github.com/spf13/cobra"
-	"gopkg.in/yaml.v2"
 )
 
 var (
 	harpoonFile string
+	hermetic    bool
+	perTest     bool
+	rebuild     bool
+	selectTests bool
 )
 
 // huntCmd represents the create args
@@ -42,32 +51,78 @@ var huntCmd = &cobra.Command{
 	SilenceUsage:  true,
 	SilenceErrors: true,
 	RunE: func(cmd *cobra.Command, args []string) error {
-		file, err := os.Open(harpoonFile)
+		analysisReport, err := readReport(harpoonFile)
 		if err != nil {
-			return fmt.Errorf("failed to open %s: %w", harpoonFile, err)
+			return err
 		}
-		defer file.Close()
 
-		byteValue, err := io.ReadAll(file)
+		var rec *recorder.Recorder
+		if recordFile != "" {
+			rec, err = recorder.Create(recordFile)
+			if err != nil {
+				return fmt.Errorf("error setting up recording: %w", err)
+			}
+			defer rec.Close()
+		}
+
+		// on SIGINT/SIGTERM the running test binary is stopped,
+		// and the syscalls collected so far are written.
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+
+		// the options are the same for every test binary.
+		cmdOpts := captor.CaptureOptions{}
+		env, err := setupCommand(&cmdOpts)
 		if err != nil {
-			return fmt.Errorf("failed to read file %q: %w", file.Name(), err)
+			return err
+		}
+		var sb sandboxSetup
+		if hermetic {
+			sb.self, err = os.Executable()
+			if err != nil {
+				return fmt.Errorf("error finding harpoon executable: %w", err)
+			}
+			// the namespaces are set up as root,
+			// so privileges are dropped by the wrapper.
+			sb.opts.Credential = cmdOpts.Credential
+			cmdOpts.Credential = nil
 		}
 
-		// Unmarshal the JSON data into the struct
-		var analysisReport meta.SymbolsList
-		if err := yaml.Unmarshal(byteValue, &analysisReport); err != nil {
-			return fmt.Errorf("failed to unmarshal YAML in %q: %w", harpoonFile, err)
+		variants, err := loadVariants()
+		if err != nil {
+			return err
 		}
-		//fmt.Println(analysisReport)
 
-		for _, symbolsOrigins := range analysisReport.SymbolsOrigins {
+		// the first failing test binary determines the exit status.
+		status := 0
+		for _, symbolsOrigins := range analysisReport.Origins() {
+			if err := checkTestBinary(analysisReport, symbolsOrigins, rebuild); err != nil {
+				return err
+			}
+			if selectTests && len(symbolsOrigins.SymbolTests) == 0 {
+				fmt.Printf("warning: the report has no tests of the symbols of %s, running all of them (run analyze with --call-graph)\n", symbolsOrigins.TestBinaryPath)
+			}
 			// command builder
 			var captureArgs []string
-			captureArgs = append(captureArgs, symbolsOrigins.TestBinaryPath)
+			captureArgs = append(captureArgs, analysisReport.Resolve(symbolsOrigins.TestBinaryPath))
 			opts := captor.CaptureOptions{
-				CommandOutput: commandOutput,
-				LibbpfOutput:  libbpfOutput,
-				Interval:      0,
+				CommandOutput:    commandOutput,
+				CommandError:     commandError,
+				LibbpfOutput:     libbpfOutput,
+				Interval:         0,
+				Recorder:         rec,
+				FollowGoroutines: followGoroutines,
+				Credential:       cmdOpts.Credential,
+				Dir:              cmdOpts.Dir,
+				CleanEnv:         cmdOpts.CleanEnv,
+				Isolate:          hermetic,
+				PerTest:          perTest,
+			}
+
+			// the reports of older versions don't have the package directory.
+			sb.pkgDir = ""
+			if symbolsOrigins.Dir != "" {
+				sb.pkgDir = analysisReport.Resolve(symbolsOrigins.Dir)
 			}
 
 			saveOpts := writer.WriteOptions{
@@ -75,47 +130,103 @@ var huntCmd = &cobra.Command{
 				Directory: directory,
 			}
 
-			for _, functionSymbol := range symbolsOrigins.Symbols {
-				resultCh := make(chan []uint32)
-				errorCh := make(chan error)
-				ctx := context.Background()
-
-				fmt.Println("tracing: ", symbolsOrigins.TestBinaryPath)
-				fmt.Printf("attaching probe: %s\n", functionSymbol)
-				ebpf, err := captor.InitProbes(functionSymbol, captureArgs, envVars, opts)
-				if err != nil {
-					return fmt.Errorf("error setting up ebpf module: %w", err)
-				}
-
-				// this will get incremental results
-				go func() {
-					ebpf.Capture(ctx, resultCh, errorCh)
-				}()
-
-				for {
-					select {
-					case syscalls := <-resultCh:
-						if err := writer.Write(syscalls, functionSymbol, saveOpts); err != nil {
-							return fmt.Errorf("error writing syscalls for symbol %s: %w", functionSymbol, err)
-						}
-					case err := <-errorCh:
-						if err != nil {
-							return fmt.Errorf("error capturing: %w", err)
-						}
-						return nil
+			for _, variant := range variants {
+				for _, functionSymbol := range symbolsOrigins.Symbols {
+					if ctx.Err() != nil {
+						break
+					}
+					fmt.Println("tracing: ", symbolsOrigins.TestBinaryPath)
+					printVariant(variant)
+					fmt.Printf("attaching probe: %s\n", functionSymbol)
+					symbolArgs := captureArgs
+					if selectTests {
+						symbolArgs = append(slices.Clone(captureArgs), testRunArgs(symbolsOrigins.SymbolTests[functionSymbol])...)
+					}
+					variantOpts := variantSaveOpts(saveOpts, variant)
+					code, err := repeatCapture(ctx, functionSymbol, captureRuns, variantOpts, func(run int) (traceResult, error) {
+						return huntSymbol(ctx, functionSymbol, symbolArgs, variantEnv(env, variant), sb, runOptions(opts, variant, run), variantOpts)
+					})
+					if err != nil {
+						return err
+					}
+					if status == 0 {
+						status = code
 					}
-					// at the end of each selection
-					// we break the loop to continue
-					// the hunting.
-					break
 				}
-				ebpf.Close()
 			}
 		}
+		if propagateExitCode && status != 0 {
+			return &exitCodeError{code: status}
+		}
 		return nil
 	},
 }
 
+// sandboxSetup holds what's needed to execute the test binaries
+// within the namespaces, in hermetic mode.
+type sandboxSetup struct {
+	// self is the harpoon executable, running the sandbox-exec command.
+	self string
+	opts sandbox.Options
+	// pkgDir is the directory of the package of the test binary, if known.
+	pkgDir string
+}
+
+// huntSymbol traces the function symbol during the execution of the test binary.
+// In hermetic mode, the test binary runs in the directory of its package,
+// made read-only, as go test does. A fresh scratch directory, removed once
+// completed, is used as TMPDIR (and as working directory when the package
+// directory is unknown). It's owned by the user the test binary runs as, if any.
+func huntSymbol(ctx context.Context, functionSymbol string, args, env []string, sb sandboxSetup, opts captor.CaptureOptions, saveOpts writer.WriteOptions) (traceResult, error) {
+	if !opts.Isolate {
+		return runCapture(ctx, functionSymbol, args, env, opts, saveOpts)
+	}
+
+	scratch, err := os.MkdirTemp("", "harpoon-hunt-")
+	if err != nil {
+		return traceResult{}, fmt.Errorf("error creating scratch directory: %w", err)
+	}
+	defer os.RemoveAll(scratch)
+	if cred := sb.opts.Credential; cred != nil {
+		if err := os.Chown(scratch, int(cred.Uid), int(cred.Gid)); err != nil {
+			return traceResult{}, fmt.Errorf("error setting owner of scratch directory: %w", err)
+		}
+	}
+
+	sandboxOpts := sb.opts
+	if sb.pkgDir != "" {
+		sandboxOpts.ReadOnlyDirs = []string{sb.pkgDir}
+	}
+	sandboxOpts.Dir = opts.Dir
+	if sandboxOpts.Dir == "" {
+		sandboxOpts.Dir = sb.pkgDir
+	}
+	if sandboxOpts.Dir == "" {
+		sandboxOpts.Dir = scratch
+	}
+	opts.Wrapper = sandboxExecWrapper(sb.self, sandboxOpts)
+	env = append(slices.Clone(env), "TMPDIR="+scratch)
+	return runCapture(ctx, functionSymbol, args, env, opts, saveOpts)
+}
+
+// testRunArgs returns the arguments of the test binary
+// running only the given tests, or all of them when there are none.
+func testRunArgs(tests []string) []string {
+	if len(tests) == 0 {
+		return nil
+	}
+	names := make([]string, len(tests))
+	for i, test := range tests {
+		names[i] = regexp.QuoteMeta(test)
+	}
+	return []string{"-test.run", "^(" + strings.Join(names, "|") + ")$"}
+}
+
+// readReport reads the report generated by the analyze command.
+func readReport(path string) (*meta.SymbolsList, error) {
+	return meta.Load(path)
+}
+
 func init() {
 	rootCmd.AddCommand(huntCmd)
 
@@ -125,9 +236,25 @@ func init() {
 	huntCmd.Flags().BoolVarP(&commandOutput, "include-cmd-stdout", "c", false, "Include the executed command output")
 	huntCmd.Flags().BoolVarP(&commandError, "include-cmd-stderr", "e", false, "Include the executed command error")
 
+	huntCmd.Flags().StringSliceVarP(&envVars, "env-var", "E", []string{}, "Environment variable to be passed to the test binaries")
+	huntCmd.Flags().StringVar(&envFile, "env-file", "", "File with the environment variables (KEY=VALUE) to be passed to the test binaries")
+	huntCmd.Flags().IntVar(&captureRuns, "runs", 1, "Number of times each test binary is executed, to find the flaky system calls")
+	huntCmd.Flags().StringVar(&envMatrixFile, "env-matrix", "", "File with the environment variants the test binaries are executed with, one at a time")
+	huntCmd.Flags().BoolVar(&cleanEnv, "clean-env", false, "Don't pass the harpoon environment to the test binaries")
+	huntCmd.Flags().StringVarP(&runAsUser, "user", "u", "", "Execute the test binaries as the given user (default $SUDO_UID)")
+	huntCmd.Flags().StringVar(&runAsGroup, "group", "", "Execute the test binaries as the given group (default $SUDO_GID)")
+	huntCmd.Flags().StringVarP(&workDir, "workdir", "w", "", "Working directory of the test binaries")
+	huntCmd.Flags().BoolVar(&hermetic, "hermetic", false, "Execute each test binary in new mount, network, pid and ipc namespaces, within its read-only package directory")
+	huntCmd.Flags().BoolVar(&propagateExitCode, "exit-code", false, "Exit with the status of the first failing test binary")
+	huntCmd.Flags().BoolVar(&selectTests, "select-tests", false, "Run only the tests referencing the traced function, as found by analyze")
+	huntCmd.Flags().BoolVar(&rebuild, "rebuild", false, "Build again the test binaries which changed, or whose sources changed, since the analysis")
+
+	huntCmd.Flags().BoolVarP(&followGoroutines, "follow-goroutines", "g", false, "Charge to the traced function the syscalls of the goroutines it spawns")
+	huntCmd.Flags().BoolVar(&perTest, "per-test", false, "Attribute the system calls to the tests (and subtests) making them")
 	huntCmd.Flags().BoolVarP(&libbpfOutput, "include-libbpf-output", "l", false, "Include the libbpf output")
 
 	huntCmd.Flags().BoolVarP(&save, "save", "S", false, "Save output to a file")
 	huntCmd.Flags().StringVarP(&directory, "directory", "D", "", "Store saved files in a directory")
 	huntCmd.MarkFlagsRequiredTogether("save", "directory")
+	huntCmd.Flags().StringVarP(&recordFile, "record", "r", "", "Record the raw event stream into a file, to be processed later with replay")
 }
@@ -0,0 +1,123 @@
+/*
+Copyright © 2024 Alessio Greggi
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"slices"
+
+	"github.com/alegrey91/harpoon/internal/envmatrix"
+	"github.com/alegrey91/harpoon/internal/recorder"
+	seccomp "github.com/alegrey91/harpoon/internal/seccomputils"
+	"github.com/alegrey91/harpoon/internal/syscallutils"
+	"github.com/alegrey91/harpoon/internal/testmap"
+	"github.com/alegrey91/harpoon/internal/writer"
+	"github.com/spf13/cobra"
+)
+
+var replayFile string
+
+// replayCmd represents the create args
+var replayCmd = &cobra.Command{
+	Use:   "replay",
+	Short: "Replay processes a recorded event stream offline",
+	Long: `Replay reads the raw events recorded with the --record flag
+of capture and hunt, and writes the system calls of each symbol
+as if they were just captured: in the directory of their variant,
+with the stats of the runs, and the system calls of each test.
+This doesn't require root privileges.
+`,
+	Example:       "  harpoon replay --file events.jsonl -S -D ./harpoon/",
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		file, err := os.Open(replayFile)
+		if err != nil {
+			return fmt.Errorf("failed to open %s: %w", replayFile, err)
+		}
+		defer file.Close()
+
+		reader, err := recorder.NewReader(file)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", replayFile, err)
+		}
+
+		captures, err := recorder.ReadCaptures(reader)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", replayFile, err)
+		}
+
+		saveOpts := writer.WriteOptions{
+			Save:      save,
+			Directory: directory,
+		}
+		for _, c := range captures {
+			variant := envmatrix.Variant{Name: c.Variant}
+			printVariant(variant)
+			variantOpts := variantSaveOpts(saveOpts, variant)
+			_, err := repeatCapture(context.Background(), c.Symbol, len(c.Runs), variantOpts, func(run int) (traceResult, error) {
+				return replayRun(c, run, variantOpts)
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+}
+
+// replayRun writes the results of the recorded run as runCapture does.
+func replayRun(c *recorder.Capture, run int, saveOpts writer.WriteOptions) (traceResult, error) {
+	result := traceResult{tests: make(testmap.Tests)}
+	testSyscalls := make(map[string][]uint32)
+	for _, e := range c.Runs[run-1] {
+		if e.Kind == recorder.KindIOUring {
+			op := syscallutils.IOUringOpName(e.SyscallID)
+			if !slices.Contains(result.ioUringOps, op) {
+				result.ioUringOps = append(result.ioUringOps, op)
+			}
+			continue
+		}
+		result.syscalls = append(result.syscalls, e.SyscallID)
+		if e.Test != "" {
+			testSyscalls[e.Test] = append(testSyscalls[e.Test], e.SyscallID)
+		}
+	}
+	for test, syscalls := range testSyscalls {
+		names, err := seccomp.Names(syscalls)
+		if err != nil {
+			return result, err
+		}
+		result.tests.Add(test, names)
+	}
+	if err := writer.Write(result.syscalls, c.Symbol, saveOpts); err != nil {
+		return result, fmt.Errorf("error writing syscalls for symbol %s: %w", c.Symbol, err)
+	}
+	return result, writeTraceResult(c.Symbol, result, c.PerTest, saveOpts)
+}
+
+func init() {
+	rootCmd.AddCommand(replayCmd)
+
+	replayCmd.Flags().StringVarP(&replayFile, "file", "F", "", "File with the recorded events")
+	replayCmd.MarkFlagRequired("file")
+
+	replayCmd.Flags().BoolVarP(&save, "save", "S", false, "Save output to a file")
+	replayCmd.Flags().StringVarP(&directory, "directory", "D", "", "Store saved files in a directory")
+	replayCmd.MarkFlagsRequiredTogether("save", "directory")
+}
@@ -0,0 +1,65 @@
+/*
+Copyright © 2024 Alessio Greggi
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	meta "github.com/alegrey91/harpoon/internal/metadata"
+	"github.com/spf13/cobra"
+)
+
+// reportCmd represents the create args
+var reportCmd = &cobra.Command{
+	Use:   "report",
+	Short: "Report groups the commands handling the analysis reports",
+	Long: `
+`,
+}
+
+// reportValidateCmd represents the create args
+var reportValidateCmd = &cobra.Command{
+	Use:   "validate [file]",
+	Short: "Validate checks the report written by analyze against its schema",
+	Long: `Validate checks the version of the report is supported,
+its fields are known and every test binary has some symbols.
+`,
+	Example:       "  harpoon report validate harpoon-report.yml",
+	Args:          cobra.MaximumNArgs(1),
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		path := analysisReportFile
+		if len(args) > 0 {
+			path = args[0]
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", path, err)
+		}
+		if err := meta.Validate(data); err != nil {
+			return fmt.Errorf("report %s is not valid:\n%w", path, err)
+		}
+		fmt.Printf("report %s is valid (version %d)\n", path, meta.Version)
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(reportCmd)
+	reportCmd.AddCommand(reportValidateCmd)
+}
@@ -0,0 +1,71 @@
+/*
+Copyright © 2024 Alessio Greggi
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"syscall"
+
+	"github.com/alegrey91/harpoon/internal/sandbox"
+	"github.com/spf13/cobra"
+)
+
+// sandboxExecCmdName is the name of the command used by hunt
+// to set up the namespaces of the test binaries right before their exec.
+const sandboxExecCmdName = "sandbox-exec"
+
+// sandboxExecCmd represents the sandbox-exec command
+var sandboxExecCmd = &cobra.Command{
+	Use:           sandboxExecCmdName,
+	Short:         "Execute a command within the namespaces created by hunt",
+	Hidden:        true,
+	Args:          cobra.MinimumNArgs(1),
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		opts, err := sandbox.ParseFlags(cmd.Flags())
+		if err != nil {
+			return err
+		}
+		if err := sandbox.Setup(opts); err != nil {
+			return err
+		}
+
+		binPath, err := exec.LookPath(args[0])
+		if err != nil {
+			return fmt.Errorf("command execution error: %w", err)
+		}
+		if err := syscall.Exec(binPath, args, os.Environ()); err != nil {
+			return fmt.Errorf("command execution error: %w", err)
+		}
+		return nil
+	},
+}
+
+// sandboxExecWrapper returns the command executing the test binaries
+// within the namespaces, set up with the given options.
+func sandboxExecWrapper(self string, opts sandbox.Options) []string {
+	wrapper := append([]string{self, sandboxExecCmdName}, opts.Args()...)
+	return append(wrapper, "--")
+}
+
+func init() {
+	rootCmd.AddCommand(sandboxExecCmd)
+
+	sandbox.AddFlags(sandboxExecCmd.Flags())
+}
@@ -0,0 +1,73 @@
+/*
+Copyright © 2024 Alessio Greggi
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"syscall"
+
+	seccomp "github.com/alegrey91/harpoon/internal/seccomputils"
+	"github.com/spf13/cobra"
+)
+
+// seccompExecCmdName is the name of the command used by verify
+// to install the profile on the traced command right before its exec.
+const seccompExecCmdName = "seccomp-exec"
+
+var seccompExecProfile string
+var seccompExecAction string
+
+// seccompExecCmd represents the seccomp-exec command
+var seccompExecCmd = &cobra.Command{
+	Use:           seccompExecCmdName,
+	Short:         "Execute a command with a seccomp profile installed",
+	Hidden:        true,
+	Args:          cobra.MinimumNArgs(1),
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		profile, err := seccomp.LoadProfile(seccompExecProfile)
+		if err != nil {
+			return err
+		}
+
+		binPath, err := exec.LookPath(args[0])
+		if err != nil {
+			return fmt.Errorf("command execution error: %w", err)
+		}
+
+		// the filter is applied to the thread executing the command.
+		runtime.LockOSThread()
+		if err := profile.Install(seccompExecAction); err != nil {
+			return err
+		}
+		if err := syscall.Exec(binPath, args, os.Environ()); err != nil {
+			return fmt.Errorf("command execution error: %w", err)
+		}
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(seccompExecCmd)
+
+	seccompExecCmd.Flags().StringVar(&seccompExecProfile, "profile", "", "Seccomp profile to be installed")
+	seccompExecCmd.MarkFlagRequired("profile")
+	seccompExecCmd.Flags().StringVar(&seccompExecAction, "action", seccomp.VerifyActionLog, "Action for the denied system calls (log, errno)")
+}
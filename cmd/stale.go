@@ -0,0 +1,166 @@
+/*
+Copyright © 2024 Alessio Greggi
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/alegrey91/harpoon/internal/analyzer"
+	"github.com/alegrey91/harpoon/internal/buildcache"
+	"github.com/alegrey91/harpoon/internal/elfreader"
+	"github.com/alegrey91/harpoon/internal/executor"
+	meta "github.com/alegrey91/harpoon/internal/metadata"
+)
+
+// testBinaryIdentity returns the digest and the Go build ID of the test binary.
+func testBinaryIdentity(path string) (digest, buildID string, err error) {
+	digest, err = meta.FileDigest(path)
+	if err != nil {
+		return "", "", err
+	}
+	elf, err := elfreader.NewElfReader(path)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to initialize elf file: %v", err)
+	}
+	defer elf.Close()
+	buildID, err = elf.BuildID()
+	if err != nil {
+		return "", "", fmt.Errorf("failed to get build ID of %s: %v", path, err)
+	}
+	return digest, buildID, nil
+}
+
+// reportBuildOptions returns the options the test binaries
+// of the report were built with.
+func reportBuildOptions(report *meta.SymbolsList) executor.BuildOptions {
+	if report.Build == nil {
+		return executor.BuildOptions{}
+	}
+	return executor.BuildOptions{
+		GoBin: report.Build.Go,
+		Tags:  report.Build.Tags,
+		Flags: report.Build.Flags,
+		Env:   report.Build.Env,
+	}
+}
+
+// staleReasons returns why the test binary doesn't match
+// the one analyzed, if it doesn't: the binary is missing or changed,
+// or its sources changed since the analysis.
+// The sources are not checked when the go tool can't list them.
+func staleReasons(report *meta.SymbolsList, so meta.SymbolsOrigin) []string {
+	binPath := report.Resolve(so.TestBinaryPath)
+	if _, err := os.Stat(binPath); err != nil {
+		return []string{"the test binary is missing"}
+	}
+
+	var reasons []string
+	if so.Digest != "" {
+		digest, buildID, err := testBinaryIdentity(binPath)
+		switch {
+		case err != nil:
+			reasons = append(reasons, err.Error())
+		case digest != so.Digest:
+			reasons = append(reasons, fmt.Sprintf("the test binary changed (build ID %s, analyzed %s)", buildID, so.BuildID))
+		}
+	}
+
+	if so.InputsDigest != "" && so.Dir != "" {
+		digest, err := sourcesDigest(report, so)
+		switch {
+		case err != nil:
+			fmt.Printf("warning: unable to check the sources of %s: %v\n", so.TestBinaryPath, err)
+		case digest != so.InputsDigest:
+			reasons = append(reasons, "the sources changed")
+		}
+	}
+	return reasons
+}
+
+// sourcesDigest returns the digest of the current inputs
+// of the test binary, built with the options of the report.
+func sourcesDigest(report *meta.SymbolsList, so meta.SymbolsOrigin) (string, error) {
+	// the paths of the sources are part of the digest,
+	// so they can be checked only where they were analyzed.
+	if _, err := os.Stat(report.BaseDir); err != nil {
+		return "", fmt.Errorf("the project moved since the analysis")
+	}
+	pkgDir := report.Resolve(so.Dir)
+	buildOpts := reportBuildOptions(report)
+	pkgs, err := analyzer.ListTestPackages(pkgDir, []string{"."}, buildOpts)
+	if err != nil {
+		return "", err
+	}
+	if len(pkgs) == 0 {
+		return "", fmt.Errorf("no tests found in %s", pkgDir)
+	}
+	toolchain, err := buildcache.Toolchain(pkgDir, buildOpts)
+	if err != nil {
+		return "", err
+	}
+	key, err := buildcache.Key(toolchain, buildOpts.TestFlags(), pkgs[0].Inputs)
+	if err != nil {
+		return "", err
+	}
+	return "sha256:" + key, nil
+}
+
+// checkTestBinary warns when the test binary is stale or,
+// with rebuild, builds it again from the directory of its package,
+// with the options recorded in the report, and records
+// the digests of the new binary in the report file.
+func checkTestBinary(report *meta.SymbolsList, so meta.SymbolsOrigin, rebuild bool) error {
+	reasons := staleReasons(report, so)
+	if len(reasons) == 0 {
+		return nil
+	}
+	if !rebuild || so.Dir == "" {
+		fmt.Printf("warning: test binary %s is stale: %s (run with --rebuild to build it again)\n", so.TestBinaryPath, strings.Join(reasons, ", "))
+		return nil
+	}
+
+	fmt.Printf("rebuilding stale test binary %s: %s\n", so.TestBinaryPath, strings.Join(reasons, ", "))
+	binPath, err := filepath.Abs(report.Resolve(so.TestBinaryPath))
+	if err != nil {
+		return fmt.Errorf("error resolving path of %s: %w", so.TestBinaryPath, err)
+	}
+	if _, err := executor.Build(report.Resolve(so.Dir), ".", binPath, reportBuildOptions(report)); err != nil {
+		return fmt.Errorf("failed to build test file: %v", err)
+	}
+
+	// the report is updated, so that the binary
+	// is not found stale (and built) again by the next runs.
+	so.Digest, so.BuildID, err = testBinaryIdentity(binPath)
+	if err != nil {
+		return err
+	}
+	if so.InputsDigest != "" {
+		digest, err := sourcesDigest(report, so)
+		if err != nil {
+			fmt.Printf("warning: unable to check the sources of %s: %v\n", so.TestBinaryPath, err)
+		} else {
+			so.InputsDigest = digest
+		}
+	}
+	report.UpdateOrigin(so)
+	if err := report.Save(); err != nil {
+		fmt.Printf("warning: unable to update the report: %v\n", err)
+	}
+	return nil
+}
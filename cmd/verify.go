@@ -0,0 +1,176 @@
+/*
+Copyright © 2024 Alessio Greggi
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+
+	"github.com/alegrey91/harpoon/internal/ebpf/probesfacade/captor"
+	seccomp "github.com/alegrey91/harpoon/internal/seccomputils"
+	"github.com/spf13/cobra"
+)
+
+var verifyProfile string
+var verifyAction string
+var verifyReportFile string
+
+// verifyTarget is a command to be executed,
+// with the symbols to be traced during its execution.
+type verifyTarget struct {
+	args    []string
+	symbols []string
+}
+
+// verifyCmd represents the verify command
+var verifyCmd = &cobra.Command{
+	Use:   "verify",
+	Short: "Verify enforces a seccomp profile on the traced command",
+	Long: `Verify executes the command with the seccomp profile installed,
+and reports the traced system calls denied by the rules of the profile,
+along with the function symbol that was running at the time.
+The denied system calls are logged by the kernel (and let through) by default,
+or failed with EPERM when using --action errno.
+The system calls needed to execute the command and start the Go runtime
+are always let through, but still reported when denied.
+`,
+	Example: `  harpoon verify --profile seccomp.json -f main.doSomething -- ./command arg1 arg2 ...
+  harpoon verify --profile seccomp.json --file harpoon-report.yml`,
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	PreRunE: func(cmd *cobra.Command, args []string) error {
+		if verifyAction != seccomp.VerifyActionLog && verifyAction != seccomp.VerifyActionErrno {
+			return fmt.Errorf("unknown action %q, expected %s or %s", verifyAction, seccomp.VerifyActionLog, seccomp.VerifyActionErrno)
+		}
+		if verifyReportFile == "" && len(functionSymbols) == 0 {
+			return errors.New("either --function or --file must be provided")
+		}
+		return nil
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		profile, err := seccomp.LoadProfile(verifyProfile)
+		if err != nil {
+			return err
+		}
+		profilePath, err := filepath.Abs(verifyProfile)
+		if err != nil {
+			return fmt.Errorf("error resolving path of %s: %w", verifyProfile, err)
+		}
+		self, err := os.Executable()
+		if err != nil {
+			return fmt.Errorf("error finding harpoon executable: %w", err)
+		}
+
+		opts := captor.CaptureOptions{
+			CommandOutput: commandOutput,
+			CommandError:  commandError,
+			LibbpfOutput:  libbpfOutput,
+			// the profile is installed by harpoon itself,
+			// right before executing the command.
+			Wrapper: []string{
+				self, seccompExecCmdName,
+				"--profile", profilePath,
+				"--action", verifyAction,
+				"--",
+			},
+			TraceDenied:      verifyAction == seccomp.VerifyActionErrno,
+			FollowGoroutines: followGoroutines,
+		}
+		env, err := setupCommand(&opts)
+		if err != nil {
+			return err
+		}
+
+		var targets []verifyTarget
+		if verifyReportFile != "" {
+			analysisReport, err := readReport(verifyReportFile)
+			if err != nil {
+				return err
+			}
+			for _, symbolsOrigins := range analysisReport.Origins() {
+				targets = append(targets, verifyTarget{
+					args:    []string{analysisReport.Resolve(symbolsOrigins.TestBinaryPath)},
+					symbols: symbolsOrigins.Symbols,
+				})
+			}
+		} else {
+			targets = append(targets, verifyTarget{
+				args:    args,
+				symbols: functionSymbols,
+			})
+		}
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+
+		blockedCount := 0
+		for _, target := range targets {
+			for _, functionSymbol := range target.symbols {
+				if ctx.Err() != nil {
+					break
+				}
+				result, err := traceSymbol(ctx, functionSymbol, target.args, env, opts, func([]uint32) error {
+					return nil
+				})
+				if err != nil {
+					return err
+				}
+				blocked, err := profile.Blocked(result.syscalls)
+				if err != nil {
+					return err
+				}
+				for _, name := range blocked {
+					fmt.Printf("%s: %s\n", functionSymbol, name)
+				}
+				blockedCount += len(blocked)
+			}
+		}
+
+		if blockedCount > 0 {
+			return fmt.Errorf("the profile would block %d system calls", blockedCount)
+		}
+		fmt.Println("no system calls blocked by the profile")
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(verifyCmd)
+
+	verifyCmd.Flags().StringVarP(&verifyProfile, "profile", "P", "", "Seccomp profile to be verified")
+	verifyCmd.MarkFlagRequired("profile")
+	verifyCmd.Flags().StringVar(&verifyAction, "action", seccomp.VerifyActionLog, "Action for the system calls denied by the profile (log, errno)")
+
+	verifyCmd.Flags().StringSliceVarP(&functionSymbols, "function", "f", []string{}, "Name of the symbol function to be traced")
+	verifyCmd.Flags().StringVarP(&verifyReportFile, "file", "F", "", "File with the result of analysis, to verify the test binaries")
+	verifyCmd.MarkFlagsMutuallyExclusive("function", "file")
+	verifyCmd.Flags().StringSliceVarP(&envVars, "env-var", "E", []string{}, "Environment variable to be passed to the executed command")
+	verifyCmd.Flags().StringVar(&envFile, "env-file", "", "File with the environment variables (KEY=VALUE) to be passed to the executed command")
+	verifyCmd.Flags().BoolVar(&cleanEnv, "clean-env", false, "Don't pass the harpoon environment to the executed command")
+	verifyCmd.Flags().StringVarP(&runAsUser, "user", "u", "", "Execute the command as the given user (default $SUDO_UID)")
+	verifyCmd.Flags().StringVar(&runAsGroup, "group", "", "Execute the command as the given group (default $SUDO_GID)")
+	verifyCmd.Flags().StringVarP(&workDir, "workdir", "w", "", "Working directory of the executed command")
+
+	verifyCmd.Flags().BoolVarP(&commandOutput, "include-cmd-stdout", "c", false, "Include the executed command output")
+	verifyCmd.Flags().BoolVarP(&commandError, "include-cmd-stderr", "e", false, "Include the executed command error")
+	verifyCmd.Flags().BoolVarP(&followGoroutines, "follow-goroutines", "g", false, "Charge to the traced function the syscalls of the goroutines it spawns")
+	verifyCmd.Flags().BoolVarP(&libbpfOutput, "include-libbpf-output", "l", false, "Include the libbpf output")
+}
@@ -12,6 +12,26 @@ struct {
     __type(value, char[25]);
 } config_map SEC(".maps");
 
+// settings passed from the Go application
+struct settings {
+	u64 cgroup_id;
+	u32 follow_goroutines;
+	// pid (as seen from the host) of the command,
+	// set once it's started.
+	u32 target_pid;
+	// set when the syscalls are attributed to the running tests.
+	u32 per_test;
+	// offset of the name field within the testing.common struct.
+	u32 test_name_offset;
+};
+
+struct {
+    __uint(type, BPF_MAP_TYPE_ARRAY);
+    __uint(max_entries, 1);
+    __type(key, __u32);
+    __type(value, struct settings);
+} settings_map SEC(".maps");
+
 struct {
     __uint(type, BPF_MAP_TYPE_PERF_EVENT_ARRAY);
     __uint(key_size, sizeof(u32));
@@ -25,9 +45,55 @@ struct {
     __type(value, struct tracing);
 } tracing_status SEC(".maps");
 
+// goroutines (pointers to their runtime.g struct) spawned
+// by the traced function, whose syscalls are charged to it
+// until they exit.
+struct {
+    __uint(type, BPF_MAP_TYPE_HASH);
+    __uint(max_entries, 10240);
+    __type(key, u64);
+    __type(value, u32);
+} traced_goroutines SEC(".maps");
+
+// threads running runtime.newproc1 on behalf of a traced goroutine
+struct {
+    __uint(type, BPF_MAP_TYPE_HASH);
+    __uint(max_entries, 1024);
+    __type(key, u32);
+    __type(value, u32);
+} spawning_goroutines SEC(".maps");
+
+// kinds of event sent to the Go application
+#define EVENT_SYSCALL    0
+#define EVENT_IO_URING   1
+#define EVENT_TEST_START 2
+
 // used to store the data received from the event
 struct syscall_data {
+	// for io_uring events, this is the opcode of the operation
 	u32 syscall_id;
+	u32 pid;
+	u32 tid;
+	u32 kind;
+	u64 timestamp;
+	u64 args[6];
+	// goroutine running the syscall, set when attributing
+	// the syscalls to the running tests.
+	u64 goroutine;
+};
+
+#define TEST_NAME_LEN 128
+
+// sent when a test (or subtest) starts running in a goroutine.
+// the header is the same of syscall_data.
+struct test_data {
+	u32 syscall_id;
+	u32 pid;
+	u32 tid;
+	u32 kind;
+	u64 timestamp;
+	u64 goroutine;
+	char name[TEST_NAME_LEN];
 };
 
 struct tracing {
@@ -49,6 +115,41 @@ __bpf_strncmp(const void *x, const void *y, __u64 len) {
 	return 0;
 }
 
+// is_following_goroutines returns true when the Go application
+// asked to follow the goroutines spawned by the traced function.
+static __always_inline bool
+is_following_goroutines() {
+	__u32 key_map_settings = 0;
+	struct settings *st = bpf_map_lookup_elem(&settings_map, &key_map_settings);
+	return st && st->follow_goroutines != 0;
+}
+
+// set by the Go application before loading the programs,
+// when following the goroutines or attributing the syscalls to the tests.
+// Reading the goroutine from the tracepoints requires BTF and a kernel
+// providing bpf_task_pt_regs (5.15), so the verifier must drop that code
+// when it's not needed, for harpoon to run on the older kernels.
+const volatile u32 read_goroutines = 0;
+
+// current_goroutine returns the pointer to the runtime.g struct
+// of the goroutine running on the current thread, 0 when not read.
+// Go (ABIInternal) keeps it in the R14 register: this holds for the
+// syscalls made from the Go code, and the assembly (ABI0) stubs of the
+// runtime and the syscall package, which don't use R14.
+// The syscalls made from C code (cgo) can't be told apart,
+// so they are not charged to the followed goroutines (or tests).
+static __always_inline u64
+current_goroutine() {
+	if (!read_goroutines) {
+		return 0;
+	}
+	struct task_struct *task = bpf_get_current_task_btf();
+	struct pt_regs *regs = (struct pt_regs *)bpf_task_pt_regs(task);
+	u64 g = 0;
+	bpf_probe_read_kernel(&g, sizeof(g), &regs->r14);
+	return g;
+}
+
 // enter_function submit the value 0 to advice 
 // the frontend app that the function started its
 // execution
@@ -58,6 +159,13 @@ int enter_function(struct pt_regs *ctx) {
 	__u32 key_map_trace = 0;
 	tc.status = 0;
 	bpf_map_update_elem(&tracing_status, &key_map_trace, &tc, 0);
+	if (is_following_goroutines()) {
+		// the goroutine running the function is the root
+		// of the goroutines we are going to follow.
+		u64 g = ctx->r14;
+		u32 traced = 1;
+		bpf_map_update_elem(&traced_goroutines, &g, &traced, BPF_ANY);
+	}
 	bpf_printk("enter function");
 	return 0;
 }
@@ -71,29 +179,72 @@ int exit_function(struct pt_regs *ctx) {
 	__u32 key_map_trace = 0;
 	tc.status = 1;
 	bpf_map_update_elem(&tracing_status, &key_map_trace, &tc, 0);
+	if (is_following_goroutines()) {
+		u64 g = ctx->r14;
+		bpf_map_delete_elem(&traced_goroutines, &g);
+	}
 	bpf_printk("exit function");
 	return 0;
 }
 
-// trace_syscall filter out the system calls executed
-// in the system and return through a perf buffer the ones
-// executed within the function defined by the uprobes.
-SEC("tracepoint/raw_syscalls/sys_enter")
-int trace_syscall(struct trace_event_raw_sys_enter* args) {
-	struct syscall_data data = {};
-	struct tracing *tc;
+// enter_newproc is attached to runtime.newproc1 and takes note
+// of the goroutines being created by a traced goroutine.
+// newproc1(fn *funcval, callergp *g, ...) receives the caller
+// goroutine as second argument (RBX).
+SEC("uprobe/enter_newproc")
+int enter_newproc(struct pt_regs *ctx) {
+	u64 callergp = ctx->bx;
+	if (!bpf_map_lookup_elem(&traced_goroutines, &callergp)) {
+		return 0;
+	}
+	u32 tid = (u32)bpf_get_current_pid_tgid();
+	u32 spawning = 1;
+	bpf_map_update_elem(&spawning_goroutines, &tid, &spawning, BPF_ANY);
+	return 0;
+}
+
+// exit_newproc is attached to the RET instructions of runtime.newproc1
+// and marks the new goroutine (returned in RAX) as traced.
+SEC("uprobe/exit_newproc")
+int exit_newproc(struct pt_regs *ctx) {
+	u32 tid = (u32)bpf_get_current_pid_tgid();
+	if (!bpf_map_lookup_elem(&spawning_goroutines, &tid)) {
+		return 0;
+	}
+	bpf_map_delete_elem(&spawning_goroutines, &tid);
+	u64 newg = ctx->ax;
+	u32 traced = 1;
+	bpf_map_update_elem(&traced_goroutines, &newg, &traced, BPF_ANY);
+	return 0;
+}
+
+// enter_goexit is attached to runtime.goexit1 and stops
+// following the goroutine once it exits.
+SEC("uprobe/enter_goexit")
+int enter_goexit(struct pt_regs *ctx) {
+	u64 g = ctx->r14;
+	bpf_map_delete_elem(&traced_goroutines, &g);
+	return 0;
+}
+
+// is_target_process returns true if the current process
+// is the one we want to trace.
+static __always_inline bool
+is_target_process() {
 	char comm[25];
 	__u32 key_map_config = 0;
-	__u32 key_map_trace = 0;
 
-	tc = bpf_map_lookup_elem(&tracing_status, &key_map_trace);
-	if (!tc) {
-		//bpf_printk("error getting tracing status");
-		return 1;
+	__u32 key_map_settings = 0;
+	struct settings *st = bpf_map_lookup_elem(&settings_map, &key_map_settings);
+	if (st && st->cgroup_id != 0) {
+		// when a cgroup is provided, we trace every process
+		// belonging to it, regardless of its command name.
+		return bpf_get_current_cgroup_id() == st->cgroup_id;
 	}
-	if (tc->status != 0) {
-		//bpf_printk("tracing is not active, status=%d", tc->status);
-		return 1;
+	if (st && st->target_pid != 0) {
+		// the helper always returns the pid from the host view,
+		// even if the process lives in a different pid namespace.
+		return (bpf_get_current_pid_tgid() >> 32) == st->target_pid;
 	}
 
 	bpf_get_current_comm(&comm, sizeof(comm));
@@ -101,7 +252,7 @@ int trace_syscall(struct trace_event_raw_sys_enter* args) {
 	// lookup command passed as argument from Go application
 	char *input_command = bpf_map_lookup_elem(&config_map, &key_map_config);
 	if (!input_command) {
-		return 1;
+		return false;
 	}
 
 	// skip if the command is not the one we want to trace
@@ -109,11 +260,112 @@ int trace_syscall(struct trace_event_raw_sys_enter* args) {
 		// This is for debugging purposes, check output with:
 		// `sudo cat /sys/kernel/debug/tracing/trace_pipe`
 		//bpf_printk("command doesn't match: %s / input command: %s\n", comm, input_command);
+		return false;
+	}
+	return true;
+}
+
+// should_trace returns true when the current event
+// happened within the function defined by the uprobes
+// (or one of the goroutines it spawned), in the process
+// we want to trace.
+static __always_inline bool
+should_trace() {
+	struct tracing *tc;
+	__u32 key_map_trace = 0;
+
+	tc = bpf_map_lookup_elem(&tracing_status, &key_map_trace);
+	if (!tc || tc->status != 0) {
+		// the function is not running, but the event
+		// could come from one of the goroutines it spawned.
+		if (!is_following_goroutines()) {
+			//bpf_printk("tracing is not active");
+			return false;
+		}
+		u64 g = current_goroutine();
+		if (!bpf_map_lookup_elem(&traced_goroutines, &g)) {
+			return false;
+		}
+	}
+
+	return is_target_process();
+}
+
+// fill_event_data sets the fields shared by all the events.
+static __always_inline void
+fill_event_data(struct syscall_data *data, u32 kind, u32 id) {
+	__u64 pid_tgid = bpf_get_current_pid_tgid();
+	data->kind = kind;
+	data->syscall_id = id;
+	data->pid = pid_tgid >> 32;
+	data->tid = (u32)pid_tgid;
+	data->timestamp = bpf_ktime_get_ns();
+
+	// the syscalls are attributed to the test
+	// running in the goroutine.
+	__u32 key_map_settings = 0;
+	struct settings *st = bpf_map_lookup_elem(&settings_map, &key_map_settings);
+	if (st && st->per_test != 0) {
+		data->goroutine = current_goroutine();
+	}
+}
+
+// enter_trunner submit the name of the test (or subtest)
+// started by testing.tRunner, along with the goroutine running it.
+// tRunner is called for every test and subtest (by testing.(*T).Run)
+// with the *T whose name is the full name (eg. TestFoo/bar).
+SEC("uprobe/enter_trunner")
+int enter_trunner(struct pt_regs *ctx) {
+	struct test_data data = {};
+
+	if (!is_target_process()) {
+		return 1;
+	}
+	__u32 key_map_settings = 0;
+	struct settings *st = bpf_map_lookup_elem(&settings_map, &key_map_settings);
+	if (!st) {
+		return 1;
+	}
+
+	u64 pid_tgid = bpf_get_current_pid_tgid();
+	data.kind = EVENT_TEST_START;
+	data.pid = pid_tgid >> 32;
+	data.tid = (u32)pid_tgid;
+	data.timestamp = bpf_ktime_get_ns();
+	data.goroutine = ctx->r14;
+
+	// t is the first argument (ABIInternal),
+	// its name is a string: pointer and length.
+	u64 t = ctx->ax;
+	u64 name_ptr = 0;
+	u64 name_len = 0;
+	bpf_probe_read_user(&name_ptr, sizeof(name_ptr), (void *)(t + st->test_name_offset));
+	bpf_probe_read_user(&name_len, sizeof(name_len), (void *)(t + st->test_name_offset + 8));
+	if (name_len > TEST_NAME_LEN - 1) {
+		name_len = TEST_NAME_LEN - 1;
+	}
+	bpf_probe_read_user(&data.name, name_len & (TEST_NAME_LEN - 1), (void *)name_ptr);
+
+	bpf_perf_event_output(ctx, &events, BPF_F_CURRENT_CPU, &data, sizeof(data));
+	return 0;
+}
+
+// trace_syscall filter out the system calls executed
+// in the system and return through a perf buffer the ones
+// executed within the function defined by the uprobes.
+SEC("tracepoint/raw_syscalls/sys_enter")
+int trace_syscall(struct trace_event_raw_sys_enter* args) {
+	struct syscall_data data = {};
+
+	if (!should_trace()) {
 		return 1;
 	}
 
 	int id = (int)args->id;
-	data.syscall_id = id;
+	fill_event_data(&data, EVENT_SYSCALL, id);
+	for (int i = 0; i < 6; i++) {
+		data.args[i] = args->args[i];
+	}
 	bpf_perf_event_output(args, &events, BPF_F_CURRENT_CPU, &data, sizeof(data));
 
 	//u32 cpu = bpf_get_smp_processor_id();
@@ -122,6 +374,57 @@ int trace_syscall(struct trace_event_raw_sys_enter* args) {
 	return 0;
 }
 
+// EPERM is the errno returned for the system calls
+// denied by the seccomp profile in verify mode.
+#define EPERM 1
+
+// trace_denied_syscall return through a perf buffer the system calls
+// failed with EPERM within the function defined by the uprobes.
+// When seccomp denies a system call with an errno, the sys_enter
+// tracepoint is skipped, so we can only see it on its way out.
+// The system calls legitimately failed with EPERM are filtered out
+// by the Go application, since they are allowed by the profile.
+SEC("tracepoint/raw_syscalls/sys_exit")
+int trace_denied_syscall(struct trace_event_raw_sys_exit* args) {
+	struct syscall_data data = {};
+
+	if (args->ret != -EPERM) {
+		return 1;
+	}
+	if (!should_trace()) {
+		return 1;
+	}
+
+	int id = (int)args->id;
+	fill_event_data(&data, EVENT_SYSCALL, id);
+	bpf_perf_event_output(args, &events, BPF_F_CURRENT_CPU, &data, sizeof(data));
+
+	bpf_printk("sending denied syscall ID: %d", id);
+	return 0;
+}
+
+// trace_io_uring_submit return through a perf buffer
+// the opcodes of the io_uring operations submitted within
+// the function defined by the uprobes.
+// These operations are executed by the kernel on behalf
+// of the process without passing through the syscalls,
+// so they are not visible from the sys_enter tracepoint.
+SEC("tracepoint/io_uring/io_uring_submit_req")
+int trace_io_uring_submit(struct trace_event_raw_io_uring_submit_req* args) {
+	struct syscall_data data = {};
+
+	if (!should_trace()) {
+		return 1;
+	}
+
+	u32 opcode = args->opcode;
+	fill_event_data(&data, EVENT_IO_URING, opcode);
+	bpf_perf_event_output(args, &events, BPF_F_CURRENT_CPU, &data, sizeof(data));
+
+	bpf_printk("sending io_uring opcode: %d", opcode);
+	return 0;
+}
+
 /*
 	Used to unlock some useful helpers
 	More information here:
@@ -1,6 +1,6 @@
 module github.com/alegrey91/harpoon
 
-go 1.23
+go 1.23.0
 
 toolchain go1.23.2
 
@@ -11,15 +11,15 @@ require (
 	golang.org/x/arch v0.7.0
 )
 
-require (
-	github.com/inconshreveable/mousetrap v1.1.0 // indirect
-	github.com/spf13/pflag v1.0.5 // indirect
-	golang.org/x/tools v0.22.0 // indirect
-)
+require github.com/inconshreveable/mousetrap v1.1.0 // indirect
 
 require (
 	github.com/rogpeppe/go-internal v1.13.1
 	github.com/spf13/cobra v1.8.0
-	golang.org/x/sys v0.21.0 // indirect
+	github.com/spf13/pflag v1.0.5
+	golang.org/x/mod v0.27.0
+	golang.org/x/sync v0.16.0
+	golang.org/x/sys v0.35.0
+	golang.org/x/tools v0.36.0
 	gopkg.in/yaml.v2 v2.4.0
 )
@@ -0,0 +1,219 @@
+// Package harpoontest records the system calls made by a function
+// from within its tests, to assert its syscall contract.
+//
+//	func TestReadConfig(t *testing.T) {
+//		harpoontest.AssertOnly(t, func() {
+//			readConfig("testdata/config.yml")
+//		}, "openat", "read", "close")
+//	}
+//
+// The system calls are captured with the same ebpf programs used by harpoon,
+// so the tests need the privileges to load them (eg. go test -exec sudo).
+// Otherwise they are skipped.
+//
+// While fn runs, the system calls of the whole test process are captured:
+// those made at the same time by other goroutines (eg. parallel tests,
+// or the garbage collector) are recorded as well.
+package harpoontest
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/alegrey91/harpoon/internal/ebpf/probesfacade/captor"
+	"github.com/alegrey91/harpoon/internal/recorder"
+	seccomp "github.com/alegrey91/harpoon/internal/seccomputils"
+)
+
+var update = flag.Bool("harpoon.update", false, "Update the harpoontest golden files")
+
+// mu serializes the recordings: the probes are attached
+// to the same function, so they can't tell each other apart.
+var mu sync.Mutex
+
+// sentinelArg is passed to the sentinel system call,
+// to tell it apart from the ones made by the recorded function.
+const sentinelArg = 0x6861727030306e
+
+// flushTimeout is how long the sentinel system call is waited for.
+const flushTimeout = 5 * time.Second
+
+// traced runs the function being recorded.
+// The probes are attached to it, and the goroutine
+// running it (with the ones it spawns) is traced.
+// Once fn returns, the sentinel system call marks the end
+// of the recording: all the events before it have been received
+// when it's received.
+//
+//go:noinline
+func traced(fn func()) {
+	fn()
+	syscall.RawSyscall(syscall.SYS_GETPID, sentinelArg, sentinelArg, sentinelArg)
+}
+
+// isSentinel returns true for the sentinel system call made by traced.
+func isSentinel(e recorder.Event) bool {
+	return e.Kind == "" && e.SyscallID == syscall.SYS_GETPID &&
+		len(e.Args) >= 3 && e.Args[0] == sentinelArg && e.Args[1] == sentinelArg && e.Args[2] == sentinelArg
+}
+
+// Record returns the system calls made by fn (and the goroutines it spawns),
+// sorted and without duplicates.
+// The test is skipped when the ebpf programs can't be loaded
+// because of missing privileges.
+func Record(t testing.TB, fn func()) []string {
+	t.Helper()
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	// the events are collected as soon as they are received,
+	// to know when the sentinel system call is received.
+	var syscalls []uint32
+	flushed := make(chan struct{})
+	var flushOnce sync.Once
+	symbol := runtime.FuncForPC(reflect.ValueOf(traced).Pointer()).Name()
+	opts := captor.CaptureOptions{
+		AttachPID:        os.Getpid(),
+		FollowGoroutines: true,
+		OnEvent: func(e recorder.Event) {
+			switch {
+			case isSentinel(e):
+				flushOnce.Do(func() { close(flushed) })
+			case e.Kind == "":
+				syscalls = append(syscalls, e.SyscallID)
+			}
+		},
+	}
+	ebpf, err := captor.InitProbes(symbol, nil, nil, opts)
+	if errors.Is(err, captor.ErrPermission) {
+		t.Skipf("harpoontest: %v", err)
+	}
+	if err != nil {
+		t.Fatalf("harpoontest: error setting up ebpf module: %v", err)
+	}
+	defer ebpf.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	resultCh := make(chan []uint32)
+	errorCh := make(chan error)
+	go ebpf.Capture(ctx, resultCh, errorCh)
+
+	traced(fn)
+	// the capture of our own process lasts until it's stopped,
+	// which drops the events not received yet.
+	timeout := time.NewTimer(flushTimeout)
+	defer timeout.Stop()
+	select {
+	case <-flushed:
+	case <-timeout.C:
+		cancel()
+		for range resultCh {
+		}
+		t.Fatalf("harpoontest: the sentinel system call was not received within %s, some system calls could be missing", flushTimeout)
+	}
+	cancel()
+
+	// the events are not collected anymore once the channel is closed.
+	for range resultCh {
+	}
+	if err := <-errorCh; err != nil {
+		t.Fatalf("harpoontest: error capturing: %v", err)
+	}
+	names, err := seccomp.Names(syscalls)
+	if err != nil {
+		t.Fatalf("harpoontest: %v", err)
+	}
+	sort.Strings(names)
+	return slices.Compact(names)
+}
+
+// AssertOnly fails the test when fn makes system calls
+// other than the allowed ones.
+func AssertOnly(t testing.TB, fn func(), allowed ...string) {
+	t.Helper()
+	if unexpected := notAllowed(Record(t, fn), allowed); len(unexpected) > 0 {
+		t.Errorf("harpoontest: unexpected system calls: %s", strings.Join(unexpected, ", "))
+	}
+}
+
+// AssertGolden fails the test when fn makes system calls
+// other than the ones listed in the golden file of the test,
+// testdata/harpoon/<test name>.golden (one system call per line).
+// Run the tests with -harpoon.update to write the golden file
+// with the system calls currently made by fn.
+func AssertGolden(t testing.TB, fn func()) {
+	t.Helper()
+	syscalls := Record(t, fn)
+	path := goldenPath(t.Name())
+	if *update {
+		if err := writeGolden(path, syscalls); err != nil {
+			t.Fatalf("harpoontest: %v", err)
+		}
+		return
+	}
+	allowed, err := readGolden(path)
+	if err != nil {
+		t.Fatalf("harpoontest: %v (run with -harpoon.update to create it)", err)
+	}
+	if unexpected := notAllowed(syscalls, allowed); len(unexpected) > 0 {
+		t.Errorf("harpoontest: unexpected system calls: %s (run with -harpoon.update to accept them)", strings.Join(unexpected, ", "))
+	}
+}
+
+// notAllowed returns the syscalls missing from the allowed ones.
+func notAllowed(syscalls, allowed []string) []string {
+	var unexpected []string
+	for _, syscall := range syscalls {
+		if !slices.Contains(allowed, syscall) {
+			unexpected = append(unexpected, syscall)
+		}
+	}
+	return unexpected
+}
+
+func goldenPath(testName string) string {
+	return filepath.Join("testdata", "harpoon", testName+".golden")
+}
+
+func readGolden(path string) ([]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading golden file: %w", err)
+	}
+	var syscalls []string
+	for _, line := range strings.Split(string(data), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			syscalls = append(syscalls, line)
+		}
+	}
+	return syscalls, nil
+}
+
+func writeGolden(path string, syscalls []string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("error creating golden file directory: %w", err)
+	}
+	data := strings.Join(syscalls, "\n")
+	if data != "" {
+		data += "\n"
+	}
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		return fmt.Errorf("error writing golden file: %w", err)
+	}
+	return nil
+}
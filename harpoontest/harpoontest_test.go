@@ -0,0 +1,99 @@
+package harpoontest
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"syscall"
+	"testing"
+
+	"github.com/alegrey91/harpoon/internal/recorder"
+)
+
+func TestNotAllowed(t *testing.T) {
+	tests := []struct {
+		name     string
+		syscalls []string
+		allowed  []string
+		want     []string
+	}{
+		{
+			name:     "allowed",
+			syscalls: []string{"read", "write"},
+			allowed:  []string{"close", "read", "write"},
+			want:     nil,
+		},
+		{
+			name:     "not allowed",
+			syscalls: []string{"openat", "read", "write"},
+			allowed:  []string{"read"},
+			want:     []string{"openat", "write"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := notAllowed(tt.syscalls, tt.allowed); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("notAllowed() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGolden(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "testdata", "harpoon", "TestGolden", "sub.golden")
+	syscalls := []string{"openat", "read"}
+	if err := writeGolden(path, syscalls); err != nil {
+		t.Fatalf("writeGolden() error = %v", err)
+	}
+	got, err := readGolden(path)
+	if err != nil {
+		t.Fatalf("readGolden() error = %v", err)
+	}
+	if !reflect.DeepEqual(got, syscalls) {
+		t.Errorf("readGolden() = %v, want %v", got, syscalls)
+	}
+	if _, err := readGolden(filepath.Join(t.TempDir(), "missing.golden")); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("readGolden() error = %v, want not exist", err)
+	}
+}
+
+func TestIsSentinel(t *testing.T) {
+	tests := []struct {
+		name  string
+		event recorder.Event
+		want  bool
+	}{
+		{
+			name:  "sentinel",
+			event: recorder.Event{SyscallID: syscall.SYS_GETPID, Args: []uint64{sentinelArg, sentinelArg, sentinelArg, 0, 0, 0}},
+			want:  true,
+		},
+		{
+			name:  "getpid",
+			event: recorder.Event{SyscallID: syscall.SYS_GETPID, Args: []uint64{0, 0, 0, 0, 0, 0}},
+		},
+		{
+			name:  "io_uring operation",
+			event: recorder.Event{Kind: recorder.KindIOUring, SyscallID: syscall.SYS_GETPID, Args: []uint64{sentinelArg, sentinelArg, sentinelArg}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isSentinel(tt.event); got != tt.want {
+				t.Errorf("isSentinel() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRecord(t *testing.T) {
+	syscalls := Record(t, func() {
+		os.Getpid()
+	})
+	if !slices.Contains(syscalls, "getpid") {
+		t.Errorf("Record() = %v, want getpid", syscalls)
+	}
+}
@@ -6,9 +6,15 @@ import (
 	"go/ast"
 	"go/parser"
 	"go/token"
+	"io"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/mod/modfile"
 )
 
 func isTestFunction(name string) bool {
@@ -52,19 +58,84 @@ func AnalyzeTestFile(moduleName, path string) ([]string, error) {
 	return functionList, nil
 }
 
-func GetModuleName(goModFile *os.File) (string, error) {
-	scanner := bufio.NewScanner(goModFile)
-	for scanner.Scan() {
-		line := scanner.Text()
-		if strings.HasPrefix(line, "module ") {
-			return strings.TrimSpace(strings.TrimPrefix(line, "module ")), nil
+// TestFunctions returns the names of the test functions
+// (func TestXxx(t *testing.T)) declared in the files, sorted.
+func TestFunctions(files []string) ([]string, error) {
+	decls, err := testFuncDecls(files)
+	if err != nil {
+		return nil, err
+	}
+	var tests []string
+	for _, fn := range decls {
+		tests = append(tests, fn.Name.Name)
+	}
+	sort.Strings(tests)
+	return tests, nil
+}
+
+// testFuncDecls returns the declarations of the test functions of the files.
+func testFuncDecls(files []string) ([]*ast.FuncDecl, error) {
+	var decls []*ast.FuncDecl
+	fset := token.NewFileSet()
+	for _, path := range files {
+		node, err := parser.ParseFile(fset, path, nil, parser.SkipObjectResolution)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %v", path, err)
+		}
+		for _, decl := range node.Decls {
+			fn, ok := decl.(*ast.FuncDecl)
+			if ok && fn.Recv == nil && fn.Body != nil && isTestName(fn.Name.Name) && fn.Type.Params.NumFields() == 1 {
+				decls = append(decls, fn)
+			}
 		}
 	}
+	return decls, nil
+}
 
-	if err := scanner.Err(); err != nil {
+// isTestName returns true for the names go test runs as tests:
+// Test, or Test followed by a character which is not a lowercase letter.
+func isTestName(name string) bool {
+	if !strings.HasPrefix(name, "Test") || name == "TestMain" {
+		return false
+	}
+	if len(name) == len("Test") {
+		return true
+	}
+	r, _ := utf8.DecodeRuneInString(name[len("Test"):])
+	return !unicode.IsLower(r)
+}
+
+// GetModuleName returns the module path declared in the go.mod file.
+func GetModuleName(goModFile *os.File) (string, error) {
+	data, err := io.ReadAll(goModFile)
+	if err != nil {
 		return "", fmt.Errorf("error reading %s: %v", goModFile.Name(), err)
 	}
-	return "", fmt.Errorf("unable to find module in file: %s", goModFile.Name())
+	modulePath := modfile.ModulePath(data)
+	if modulePath == "" {
+		return "", fmt.Errorf("unable to find module in file: %s", goModFile.Name())
+	}
+	return modulePath, nil
+}
+
+// FindGoMod returns the path of the go.mod file of the module
+// the directory belongs to, looking into its parent directories.
+func FindGoMod(dir string) (string, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", fmt.Errorf("error resolving path of %s: %v", dir, err)
+	}
+	for {
+		goMod := filepath.Join(dir, "go.mod")
+		if _, err := os.Stat(goMod); err == nil {
+			return goMod, nil
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", fmt.Errorf("unable to find go.mod in %s or its parents", dir)
+		}
+		dir = parent
+	}
 }
 
 func CheckFunctionExists(functionName string, goFile *os.File) (bool, error) {
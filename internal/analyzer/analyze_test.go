@@ -0,0 +1,63 @@
+package analyzer
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestTestFunctions(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"a_test.go": `package a
+
+import "testing"
+
+func TestMain(m *testing.M) {}
+
+func TestGet(t *testing.T) {}
+
+func Test_set(t *testing.T) {}
+
+func Testify(t *testing.T) {}
+
+func TestHelper() {}
+
+func BenchmarkGet(b *testing.B) {}
+
+type suite struct{}
+
+func (suite) TestMethod(t *testing.T) {}
+`,
+		"b_test.go": `package a_test
+
+import "testing"
+
+func Test(t *testing.T) {}
+
+func TestΔ(t *testing.T) {}
+`,
+	}
+	var paths []string
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		paths = append(paths, path)
+	}
+
+	got, err := TestFunctions(paths)
+	if err != nil {
+		t.Fatalf("TestFunctions() error = %v", err)
+	}
+	want := []string{"Test", "TestGet", "Test_set", "TestΔ"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("TestFunctions() = %v, want %v", got, want)
+	}
+
+	if _, err := TestFunctions([]string{filepath.Join(dir, "missing_test.go")}); err == nil {
+		t.Errorf("TestFunctions() expected error for a missing file")
+	}
+}
@@ -0,0 +1,231 @@
+package analyzer
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"golang.org/x/mod/modfile"
+)
+
+// Module is a Go module to be analyzed.
+type Module struct {
+	// Path is the module path declared in go.mod.
+	Path string
+	// Dir is the directory containing go.mod.
+	Dir string
+}
+
+// ModulePatterns is a module with the patterns of its packages to be analyzed.
+type ModulePatterns struct {
+	Module
+	// Patterns are the package patterns, relative to the module directory.
+	Patterns []string
+}
+
+// ReadModulePath returns the module path declared in the go.mod file.
+func ReadModulePath(goModPath string) (string, error) {
+	data, err := os.ReadFile(goModPath)
+	if err != nil {
+		return "", fmt.Errorf("error reading %s: %v", goModPath, err)
+	}
+	modulePath := modfile.ModulePath(data)
+	if modulePath == "" {
+		return "", fmt.Errorf("unable to find module in file: %s", goModPath)
+	}
+	return modulePath, nil
+}
+
+// FindModules returns the modules within the directory:
+// those used by its go.work file, if any,
+// otherwise the modules found walking the directory
+// (skipping vendor, testdata and the directories ignored by the go tool).
+func FindModules(dir string) ([]Module, error) {
+	workPath := filepath.Join(dir, "go.work")
+	data, err := os.ReadFile(workPath)
+	switch {
+	case err == nil:
+		return workspaceModules(dir, workPath, data)
+	case !errors.Is(err, fs.ErrNotExist):
+		return nil, fmt.Errorf("error reading %s: %v", workPath, err)
+	}
+
+	var modules []Module
+	err = filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			name := d.Name()
+			if path != dir && (name == "vendor" || name == "testdata" || strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_")) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.Name() != "go.mod" {
+			return nil
+		}
+		modulePath, err := ReadModulePath(path)
+		if err != nil {
+			return err
+		}
+		modules = append(modules, Module{Path: modulePath, Dir: filepath.Dir(path)})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(modules) == 0 {
+		return nil, fmt.Errorf("unable to find go.mod or go.work in %s", dir)
+	}
+	return modules, nil
+}
+
+// workspaceModules returns the modules used by the go.work file.
+func workspaceModules(dir, workPath string, data []byte) ([]Module, error) {
+	work, err := modfile.ParseWork(workPath, data, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing %s: %v", workPath, err)
+	}
+	var modules []Module
+	for _, use := range work.Use {
+		moduleDir := use.Path
+		if !filepath.IsAbs(moduleDir) {
+			moduleDir = filepath.Join(dir, moduleDir)
+		}
+		modulePath, err := ReadModulePath(filepath.Join(moduleDir, "go.mod"))
+		if err != nil {
+			return nil, err
+		}
+		modules = append(modules, Module{Path: modulePath, Dir: moduleDir})
+	}
+	if len(modules) == 0 {
+		return nil, fmt.Errorf("no modules used in %s", workPath)
+	}
+	return modules, nil
+}
+
+// MatchModules returns the modules with the packages matched by the patterns,
+// each with its own patterns.
+// A relative pattern (eg. ./pkg/...) goes to the module containing its directory,
+// relative to which it's rewritten, while an import path pattern
+// goes to the module with the longest path it's within.
+// A recursive pattern (eg. ./...) matches every package
+// of the modules nested in its directory as well.
+// The modules not matched by any pattern are skipped.
+// The relative patterns are relative to dir,
+// and the modules directories to the current one.
+func MatchModules(dir string, modules []Module, patterns []string) ([]ModulePatterns, error) {
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, fmt.Errorf("error resolving path of %s: %v", dir, err)
+	}
+	moduleDirs := make([]string, len(modules))
+	for i, module := range modules {
+		moduleDirs[i], err = filepath.Abs(module.Dir)
+		if err != nil {
+			return nil, fmt.Errorf("error resolving path of %s: %v", module.Dir, err)
+		}
+	}
+
+	matched := make([][]string, len(modules))
+	add := func(i int, pattern string) {
+		if !slices.Contains(matched[i], pattern) {
+			matched[i] = append(matched[i], pattern)
+		}
+	}
+	for _, pattern := range patterns {
+		base, recursive := strings.CutSuffix(pattern, "/...")
+		if pattern == "..." {
+			base, recursive = ".", true
+		}
+		found := false
+		if isLocalPattern(base) {
+			path := filepath.FromSlash(base)
+			if !filepath.IsAbs(path) {
+				path = filepath.Join(absDir, path)
+			}
+			if owner := longestWithin(moduleDirs, path, string(filepath.Separator)); owner >= 0 {
+				rel, err := filepath.Rel(moduleDirs[owner], path)
+				if err != nil {
+					return nil, fmt.Errorf("error resolving path of %s: %v", pattern, err)
+				}
+				modulePattern := "./" + filepath.ToSlash(rel)
+				if rel == "." {
+					modulePattern = "."
+				}
+				if recursive {
+					modulePattern += "/..."
+				}
+				add(owner, modulePattern)
+				found = true
+			}
+			if recursive {
+				for i, moduleDir := range moduleDirs {
+					if moduleDir != path && isWithin(moduleDir, path, string(filepath.Separator)) {
+						add(i, "./...")
+						found = true
+					}
+				}
+			}
+		} else {
+			modulePaths := make([]string, len(modules))
+			for i, module := range modules {
+				modulePaths[i] = module.Path
+			}
+			if owner := longestWithin(modulePaths, base, "/"); owner >= 0 {
+				add(owner, pattern)
+				found = true
+			}
+			if recursive {
+				for i, modulePath := range modulePaths {
+					if modulePath != base && isWithin(modulePath, base, "/") {
+						add(i, "./...")
+						found = true
+					}
+				}
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("no module contains the packages of %s", pattern)
+		}
+	}
+
+	var matches []ModulePatterns
+	for i, module := range modules {
+		if len(matched[i]) > 0 {
+			matches = append(matches, ModulePatterns{Module: module, Patterns: matched[i]})
+		}
+	}
+	return matches, nil
+}
+
+// isLocalPattern returns true if the pattern is a file system path
+// (eg. ./pkg or /src/app/pkg), rather than an import path.
+func isLocalPattern(pattern string) bool {
+	return pattern == "." || pattern == ".." ||
+		strings.HasPrefix(pattern, "./") || strings.HasPrefix(pattern, "../") ||
+		filepath.IsAbs(pattern)
+}
+
+// isWithin returns true if the path is the parent path,
+// or is within it, with the separator between their elements.
+func isWithin(path, parent, sep string) bool {
+	return path == parent || strings.HasPrefix(path, strings.TrimSuffix(parent, sep)+sep)
+}
+
+// longestWithin returns the index of the longest of the parents
+// the path is within, or -1 when there's none.
+func longestWithin(parents []string, path, sep string) int {
+	longest := -1
+	for i, parent := range parents {
+		if isWithin(path, parent, sep) && (longest < 0 || len(parent) > len(parents[longest])) {
+			longest = i
+		}
+	}
+	return longest
+}
@@ -0,0 +1,138 @@
+package analyzer
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/alegrey91/harpoon/internal/testutil"
+)
+
+func TestFindModules(t *testing.T) {
+	tests := []struct {
+		name    string
+		archive string
+		want    []Module
+		wantErr bool
+	}{
+		{
+			name:    "single module",
+			archive: "testdata/modules/single.txtar",
+			want:    []Module{{Path: "example.com/app", Dir: "."}},
+		},
+		{
+			name:    "nested modules",
+			archive: "testdata/modules/nested.txtar",
+			want: []Module{
+				{Path: "example.com/app", Dir: "."},
+				{Path: "example.com/api", Dir: "services/api"},
+				{Path: "example.com/app/tools", Dir: "tools"},
+			},
+		},
+		{
+			name:    "workspace",
+			archive: "testdata/modules/workspace.txtar",
+			want: []Module{
+				{Path: "example.com/api", Dir: "api"},
+				{Path: "example.com/cli", Dir: "cli"},
+			},
+		},
+		{
+			name:    "no module",
+			archive: "testdata/modules/no-module.txtar",
+			wantErr: true,
+		},
+		{
+			name:    "missing module directive",
+			archive: "testdata/modules/no-module-directive.txtar",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := testutil.ExtractArchive(t, tt.archive)
+			got, err := FindModules(dir)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("FindModules() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			for i := range got {
+				got[i].Dir, _ = filepath.Rel(dir, got[i].Dir)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("FindModules() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMatchModules(t *testing.T) {
+	dir := testutil.ExtractArchive(t, "testdata/modules/nested.txtar")
+	modules, err := FindModules(dir)
+	if err != nil {
+		t.Fatalf("FindModules() error = %v", err)
+	}
+	app, api, tools := modules[0], modules[1], modules[2]
+
+	tests := []struct {
+		name     string
+		patterns []string
+		want     []ModulePatterns
+		wantErr  bool
+	}{
+		{
+			name:     "all modules",
+			patterns: []string{"./..."},
+			want: []ModulePatterns{
+				{Module: app, Patterns: []string{"./..."}},
+				{Module: api, Patterns: []string{"./..."}},
+				{Module: tools, Patterns: []string{"./..."}},
+			},
+		},
+		{
+			name:     "package of the main module",
+			patterns: []string{"./internal/store"},
+			want:     []ModulePatterns{{Module: app, Patterns: []string{"./internal/store"}}},
+		},
+		{
+			name:     "packages of a nested module",
+			patterns: []string{"./services/api/...", "./tools/cmd"},
+			want: []ModulePatterns{
+				{Module: api, Patterns: []string{"./..."}},
+				{Module: tools, Patterns: []string{"./cmd"}},
+			},
+		},
+		{
+			name:     "modules nested in the pattern directory",
+			patterns: []string{"./services/..."},
+			want: []ModulePatterns{
+				{Module: app, Patterns: []string{"./services/..."}},
+				{Module: api, Patterns: []string{"./..."}},
+			},
+		},
+		{
+			name:     "import paths",
+			patterns: []string{"example.com/app/tools/cmd", "example.com/app/pkg/...", "example.com/api"},
+			want: []ModulePatterns{
+				{Module: app, Patterns: []string{"example.com/app/pkg/..."}},
+				{Module: api, Patterns: []string{"example.com/api"}},
+				{Module: tools, Patterns: []string{"example.com/app/tools/cmd"}},
+			},
+		},
+		{
+			name:     "outside the modules",
+			patterns: []string{"../other/..."},
+			wantErr:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := MatchModules(dir, modules, tt.patterns)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("MatchModules() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("MatchModules() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,162 @@
+package analyzer
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/alegrey91/harpoon/internal/executor"
+)
+
+// Package is a Go package with tests, as reported by go list.
+type Package struct {
+	ImportPath string
+	Name       string
+	Dir        string
+	// TestGoFiles are the _test.go files of the package itself,
+	// XTestGoFiles those of the external _test package.
+	// Both honor the build constraints.
+	TestGoFiles  []string
+	XTestGoFiles []string
+	// ForTest is set on the variants of the packages built for the tests.
+	ForTest string
+	// DepOnly is set on the packages listed only as dependencies.
+	DepOnly  bool
+	Standard bool
+	Deps     []string
+	Module   *struct {
+		GoMod string
+	}
+
+	GoFiles         []string
+	CgoFiles        []string
+	CFiles          []string
+	CXXFiles        []string
+	HFiles          []string
+	SFiles          []string
+	SysoFiles       []string
+	EmbedFiles      []string
+	TestEmbedFiles  []string
+	XTestEmbedFiles []string
+
+	// Inputs are the paths of the files the test binary is built from,
+	// including the ones of the dependencies outside of the standard library.
+	// They are sorted.
+	Inputs []string `json:"-"`
+}
+
+// TestFiles returns the paths of the test files of the package.
+func (p *Package) TestFiles() []string {
+	var files []string
+	for _, file := range append(append([]string{}, p.TestGoFiles...), p.XTestGoFiles...) {
+		files = append(files, filepath.Join(p.Dir, file))
+	}
+	return files
+}
+
+// sourceFiles returns the paths of the files the package is built from,
+// along with the go.mod file of its module.
+func (p *Package) sourceFiles(tests bool) []string {
+	lists := [][]string{p.GoFiles, p.CgoFiles, p.CFiles, p.CXXFiles, p.HFiles, p.SFiles, p.SysoFiles, p.EmbedFiles}
+	if tests {
+		lists = append(lists, p.TestGoFiles, p.XTestGoFiles, p.TestEmbedFiles, p.XTestEmbedFiles)
+	}
+	var files []string
+	for _, list := range lists {
+		for _, file := range list {
+			files = append(files, filepath.Join(p.Dir, file))
+		}
+	}
+	if p.Module != nil && p.Module.GoMod != "" {
+		files = append(files, p.Module.GoMod)
+	}
+	return files
+}
+
+// ListTestPackages returns the packages matching the patterns (eg. ./pkg/...)
+// which have tests, each one once, in the order reported by go list.
+// The build options (eg. the tags) select the packages and their files.
+func ListTestPackages(dir string, patterns []string, opts executor.BuildOptions) ([]Package, error) {
+	args := append([]string{"list", "-deps", "-test", "-json"}, opts.BuildFlags()...)
+	args = append(args, patterns...)
+	cmd := opts.GoCommand(dir, args...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("error listing packages: %v: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return parseTestPackages(bytes.NewReader(output))
+}
+
+// parseTestPackages reads the output of go list -deps -test -json,
+// skipping the dependencies, the test variants and the generated
+// test main packages, which are used to find the inputs of the tests.
+func parseTestPackages(r io.Reader) ([]Package, error) {
+	var pkgs []Package
+	seen := make(map[string]bool)
+	// the packages by import path, and the test main packages
+	// by the import path of the package they test.
+	all := make(map[string]*Package)
+	mains := make(map[string]*Package)
+	dec := json.NewDecoder(r)
+	for {
+		var pkg Package
+		if err := dec.Decode(&pkg); err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return nil, fmt.Errorf("error parsing go list output: %v", err)
+		}
+		if pkg.ForTest != "" {
+			continue
+		}
+		if strings.HasSuffix(pkg.ImportPath, ".test") {
+			mains[strings.TrimSuffix(pkg.ImportPath, ".test")] = &pkg
+			continue
+		}
+		all[pkg.ImportPath] = &pkg
+		if pkg.DepOnly {
+			continue
+		}
+		if len(pkg.TestGoFiles) == 0 && len(pkg.XTestGoFiles) == 0 {
+			continue
+		}
+		if seen[pkg.ImportPath] {
+			continue
+		}
+		seen[pkg.ImportPath] = true
+		pkgs = append(pkgs, pkg)
+	}
+
+	for i := range pkgs {
+		pkgs[i].Inputs = testInputs(&pkgs[i], mains[pkgs[i].ImportPath], all)
+	}
+	return pkgs, nil
+}
+
+// testInputs returns the sorted paths of the files of the package,
+// its tests and the dependencies of its test main package.
+func testInputs(pkg, main *Package, all map[string]*Package) []string {
+	inputs := pkg.sourceFiles(true)
+	if main != nil {
+		for _, dep := range main.Deps {
+			// the variants built for the tests are named "path [path.test]",
+			// their test files are the ones of the package.
+			dep, _, _ = strings.Cut(dep, " ")
+			p, ok := all[dep]
+			if !ok || p.Standard || dep == pkg.ImportPath {
+				continue
+			}
+			inputs = append(inputs, p.sourceFiles(false)...)
+		}
+	}
+	sort.Strings(inputs)
+	return slices.Compact(inputs)
+}
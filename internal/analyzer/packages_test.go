@@ -0,0 +1,87 @@
+package analyzer
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/alegrey91/harpoon/internal/executor"
+	"github.com/alegrey91/harpoon/internal/testutil"
+)
+
+func TestListTestPackages(t *testing.T) {
+	dir := testutil.ExtractArchive(t, "testdata/packages.txtar")
+	t.Setenv("GOOS", "linux")
+	t.Setenv("GOFLAGS", "-mod=mod")
+
+	tests := []struct {
+		name     string
+		patterns []string
+		opts     executor.BuildOptions
+		want     []string
+	}{
+		{
+			name:     "all packages",
+			patterns: []string{"./..."},
+			// b has tests for windows only.
+			want: []string{"example.com/app/pkg/a", "example.com/app/pkg/a/sub", "example.com/app/pkg/c"},
+		},
+		{
+			name:     "sub packages",
+			patterns: []string{"./pkg/a/..."},
+			want:     []string{"example.com/app/pkg/a", "example.com/app/pkg/a/sub"},
+		},
+		{
+			name:     "duplicated patterns",
+			patterns: []string{"./pkg/a", "example.com/app/pkg/a"},
+			want:     []string{"example.com/app/pkg/a"},
+		},
+		{
+			name:     "build tags",
+			patterns: []string{"./pkg/..."},
+			opts:     executor.BuildOptions{Tags: []string{"integration"}},
+			want:     []string{"example.com/app/pkg/a", "example.com/app/pkg/a/sub", "example.com/app/pkg/c", "example.com/app/pkg/d"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pkgs, err := ListTestPackages(dir, tt.patterns, tt.opts)
+			if err != nil {
+				t.Fatalf("ListTestPackages() error = %v", err)
+			}
+			var got []string
+			for _, pkg := range pkgs {
+				got = append(got, pkg.ImportPath)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ListTestPackages() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	pkgs, err := ListTestPackages(dir, []string{"./pkg/a"}, executor.BuildOptions{})
+	if err != nil {
+		t.Fatalf("ListTestPackages() error = %v", err)
+	}
+	wantFiles := []string{
+		filepath.Join(dir, "pkg/a/a_test.go"),
+		filepath.Join(dir, "pkg/a/external_test.go"),
+	}
+	if got := pkgs[0].TestFiles(); !reflect.DeepEqual(got, wantFiles) {
+		t.Errorf("TestFiles() = %v, want %v", got, wantFiles)
+	}
+
+	pkgs, err = ListTestPackages(dir, []string{"./pkg/c"}, executor.BuildOptions{})
+	if err != nil {
+		t.Fatalf("ListTestPackages() error = %v", err)
+	}
+	wantInputs := []string{
+		filepath.Join(dir, "go.mod"),
+		filepath.Join(dir, "pkg/b/b.go"),
+		filepath.Join(dir, "pkg/c/c.go"),
+		filepath.Join(dir, "pkg/c/c_external_test.go"),
+	}
+	if got := pkgs[0].Inputs; !reflect.DeepEqual(got, wantInputs) {
+		t.Errorf("Inputs = %v, want %v", got, wantInputs)
+	}
+}
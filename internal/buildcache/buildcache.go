@@ -0,0 +1,154 @@
+package buildcache
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/alegrey91/harpoon/internal/executor"
+)
+
+// toolchainVars are the go env variables changing the test binaries.
+var toolchainVars = []string{"GOVERSION", "GOOS", "GOARCH", "CGO_ENABLED", "GOFLAGS", "GOEXPERIMENT"}
+
+// Cache stores the test binaries, with the function symbols found in them,
+// by the digest of what they are built from.
+type Cache struct {
+	dir string
+}
+
+// New returns the cache stored in the given directory, creating it.
+func New(dir string) (*Cache, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("error creating cache directory: %w", err)
+	}
+	return &Cache{dir: dir}, nil
+}
+
+// Toolchain returns the version and the settings of the go toolchain
+// used from the given directory with the build options,
+// along with their additional variables, to be part of the keys.
+func Toolchain(dir string, opts executor.BuildOptions) (string, error) {
+	cmd := opts.GoCommand(dir, append([]string{"env"}, toolchainVars...)...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("error getting go env: %v: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return string(output) + strings.Join(opts.Env, "\n"), nil
+}
+
+// Key returns the digest of the toolchain, the build flags
+// and the path and content of the input files.
+func Key(toolchain string, flags, inputs []string) (string, error) {
+	h := sha256.New()
+	fmt.Fprintf(h, "toolchain %q\n", toolchain)
+	for _, flag := range flags {
+		fmt.Fprintf(h, "flag %q\n", flag)
+	}
+	for _, input := range inputs {
+		fmt.Fprintf(h, "file %q\n", input)
+		if err := hashFile(h, input); err != nil {
+			return "", err
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func hashFile(w io.Writer, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("error reading input file: %w", err)
+	}
+	defer f.Close()
+	if _, err := io.Copy(w, f); err != nil {
+		return fmt.Errorf("error reading input file %s: %v", path, err)
+	}
+	return nil
+}
+
+// BinaryPath returns the path the test binary of the key is stored to.
+func (c *Cache) BinaryPath(key string) string {
+	return filepath.Join(c.dir, key+".test")
+}
+
+func (c *Cache) symbolsPath(key string) string {
+	return filepath.Join(c.dir, key+".symbols")
+}
+
+// Symbols returns the function symbols of the test binary of the key,
+// if both were stored.
+func (c *Cache) Symbols(key string) ([]string, bool) {
+	if _, err := os.Stat(c.BinaryPath(key)); err != nil {
+		return nil, false
+	}
+	data, err := os.ReadFile(c.symbolsPath(key))
+	if err != nil {
+		return nil, false
+	}
+	symbols := []string{}
+	for _, line := range strings.Split(string(data), "\n") {
+		if line != "" {
+			symbols = append(symbols, line)
+		}
+	}
+	return symbols, true
+}
+
+// SaveSymbols stores the function symbols of the test binary of the key,
+// once the binary is built.
+func (c *Cache) SaveSymbols(key string, symbols []string) error {
+	var data strings.Builder
+	for _, symbol := range symbols {
+		data.WriteString(symbol + "\n")
+	}
+	// the symbols are renamed in place once written,
+	// so that an interrupted run doesn't leave a partial entry.
+	tmp, err := os.CreateTemp(c.dir, key+".symbols.*")
+	if err != nil {
+		return fmt.Errorf("error saving symbols: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.WriteString(data.String()); err != nil {
+		tmp.Close()
+		return fmt.Errorf("error saving symbols: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("error saving symbols: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), c.symbolsPath(key)); err != nil {
+		return fmt.Errorf("error saving symbols: %w", err)
+	}
+	return nil
+}
+
+// Link makes the test binary of the key available at the given path,
+// hard linking it when possible, copying it otherwise.
+func (c *Cache) Link(key, path string) error {
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("error replacing %s: %w", path, err)
+	}
+	if err := os.Link(c.BinaryPath(key), path); err == nil {
+		return nil
+	}
+	src, err := os.Open(c.BinaryPath(key))
+	if err != nil {
+		return fmt.Errorf("error reading cached test binary: %w", err)
+	}
+	defer src.Close()
+	dst, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0755)
+	if err != nil {
+		return fmt.Errorf("error copying cached test binary: %w", err)
+	}
+	if _, err := io.Copy(dst, src); err != nil {
+		dst.Close()
+		return fmt.Errorf("error copying cached test binary: %w", err)
+	}
+	return dst.Close()
+}
@@ -0,0 +1,117 @@
+package buildcache
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/alegrey91/harpoon/internal/executor"
+)
+
+func TestKey(t *testing.T) {
+	dir := t.TempDir()
+	input := filepath.Join(dir, "a.go")
+	if err := os.WriteFile(input, []byte("package a\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	key := func(toolchain string, flags []string) string {
+		t.Helper()
+		k, err := Key(toolchain, flags, []string{input})
+		if err != nil {
+			t.Fatalf("Key() error = %v", err)
+		}
+		return k
+	}
+
+	base := key("go1.23.2", []string{"-gcflags=all=-N -l"})
+	if got := key("go1.23.2", []string{"-gcflags=all=-N -l"}); got != base {
+		t.Errorf("Key() = %s, want %s for the same inputs", got, base)
+	}
+	if got := key("go1.24.0", []string{"-gcflags=all=-N -l"}); got == base {
+		t.Errorf("Key() unchanged with a different toolchain")
+	}
+	if got := key("go1.23.2", []string{"-gcflags=all=-N -l", "-race"}); got == base {
+		t.Errorf("Key() unchanged with different flags")
+	}
+	if err := os.WriteFile(input, []byte("package a\n\nfunc A() {}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if got := key("go1.23.2", []string{"-gcflags=all=-N -l"}); got == base {
+		t.Errorf("Key() unchanged with a different input")
+	}
+
+	if _, err := Key("go1.23.2", nil, []string{filepath.Join(dir, "missing.go")}); err == nil {
+		t.Errorf("Key() expected error for a missing input")
+	}
+}
+
+func TestCache(t *testing.T) {
+	dir := t.TempDir()
+	cache, err := New(filepath.Join(dir, "cache"))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	const key = "0123"
+
+	if _, ok := cache.Symbols(key); ok {
+		t.Errorf("Symbols() found an empty entry")
+	}
+	if err := os.WriteFile(cache.BinaryPath(key), []byte("binary"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	// the binary alone is not an entry, it could be partial.
+	if _, ok := cache.Symbols(key); ok {
+		t.Errorf("Symbols() found an entry without symbols")
+	}
+
+	symbols := []string{"example.com/app.A", "example.com/app.(*T).B"}
+	if err := cache.SaveSymbols(key, symbols); err != nil {
+		t.Fatalf("SaveSymbols() error = %v", err)
+	}
+	got, ok := cache.Symbols(key)
+	if !ok || !reflect.DeepEqual(got, symbols) {
+		t.Errorf("Symbols() = %v, %v, want %v, true", got, ok, symbols)
+	}
+
+	if err := cache.SaveSymbols("4567", nil); err != nil {
+		t.Fatalf("SaveSymbols() error = %v", err)
+	}
+	if err := os.WriteFile(cache.BinaryPath("4567"), nil, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if got, ok := cache.Symbols("4567"); !ok || len(got) != 0 {
+		t.Errorf("Symbols() = %v, %v, want [], true", got, ok)
+	}
+
+	path := filepath.Join(dir, "__pkg.test")
+	// an outdated binary is replaced.
+	if err := os.WriteFile(path, []byte("old"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := cache.Link(key, path); err != nil {
+		t.Fatalf("Link() error = %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil || string(data) != "binary" {
+		t.Errorf("Link() content = %q, %v, want %q", data, err, "binary")
+	}
+}
+
+func TestToolchain(t *testing.T) {
+	base, err := Toolchain(t.TempDir(), executor.BuildOptions{})
+	if err != nil {
+		t.Fatalf("Toolchain() error = %v", err)
+	}
+	if !strings.HasPrefix(base, "go") {
+		t.Errorf("Toolchain() = %q, want the go version first", base)
+	}
+	got, err := Toolchain(t.TempDir(), executor.BuildOptions{Env: []string{"CGO_ENABLED=0", "CGO_CFLAGS=-O1"}})
+	if err != nil {
+		t.Fatalf("Toolchain() error = %v", err)
+	}
+	if got == base {
+		t.Errorf("Toolchain() unchanged with a different environment")
+	}
+}
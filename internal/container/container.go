@@ -0,0 +1,109 @@
+package container
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// CgroupRoot is where the cgroup v2 hierarchy is usually mounted.
+const CgroupRoot = "/sys/fs/cgroup"
+
+// errFound is used to stop walking the cgroup hierarchy.
+var errFound = errors.New("found")
+
+// CgroupID returns the ID of the cgroup (v2) at the given path.
+// This is the same value returned by bpf_get_current_cgroup_id()
+// for the processes belonging to the cgroup.
+func CgroupID(path string) (uint64, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0, fmt.Errorf("error reading cgroup %s: %v", path, err)
+	}
+	if !info.IsDir() {
+		return 0, fmt.Errorf("cgroup %s is not a directory", path)
+	}
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, fmt.Errorf("unable to get inode of cgroup %s", path)
+	}
+	return stat.Ino, nil
+}
+
+// FindCgroup looks for the cgroup of the given container
+// within the root hierarchy.
+// Container engines name the cgroup after the container ID
+// (eg. docker-<id>.scope, cri-containerd-<id>.scope, <id>),
+// so the first directory containing the ID is returned.
+func FindCgroup(root, containerID string) (string, error) {
+	if containerID == "" {
+		return "", fmt.Errorf("container id is empty")
+	}
+	var cgroupPath string
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() && strings.Contains(d.Name(), containerID) {
+			cgroupPath = path
+			return errFound
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, errFound) {
+		return "", fmt.Errorf("error walking %s: %v", root, err)
+	}
+	if cgroupPath == "" {
+		return "", fmt.Errorf("unable to find cgroup for container %s", containerID)
+	}
+	return cgroupPath, nil
+}
+
+// CgroupProcs returns the list of processes belonging to the cgroup.
+func CgroupProcs(path string) ([]int, error) {
+	file, err := os.Open(filepath.Join(path, "cgroup.procs"))
+	if err != nil {
+		return nil, fmt.Errorf("error opening cgroup.procs: %v", err)
+	}
+	defer file.Close()
+
+	var pids []int
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		pid, err := strconv.Atoi(strings.TrimSpace(scanner.Text()))
+		if err != nil {
+			return nil, fmt.Errorf("unexpected pid %q in %s: %v", scanner.Text(), file.Name(), err)
+		}
+		pids = append(pids, pid)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading %s: %v", file.Name(), err)
+	}
+	return pids, nil
+}
+
+// ResolveBinary returns the path, as seen from the host,
+// of a binary living in the mount namespace of the given process.
+// When binPath is empty, the executable of the process is returned.
+func ResolveBinary(pid int, binPath string) string {
+	procDir := filepath.Join("/proc", strconv.Itoa(pid))
+	if binPath == "" {
+		return filepath.Join(procDir, "exe")
+	}
+	return filepath.Join(procDir, "root", filepath.Clean("/"+binPath))
+}
+
+// Comm returns the command name of the given process.
+func Comm(pid int) (string, error) {
+	comm, err := os.ReadFile(filepath.Join("/proc", strconv.Itoa(pid), "comm"))
+	if err != nil {
+		return "", fmt.Errorf("error reading comm of process %d: %v", pid, err)
+	}
+	return strings.TrimSpace(string(comm)), nil
+}
@@ -0,0 +1,123 @@
+package container
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestFindCgroup(t *testing.T) {
+	root := t.TempDir()
+	dirs := []string{
+		"system.slice/docker-4f2a9c1b7e3d.scope",
+		"kubepods.slice/kubepods-pod1.slice/cri-containerd-9a8b7c6d5e4f.scope",
+	}
+	for _, dir := range dirs {
+		if err := os.MkdirAll(filepath.Join(root, dir), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name        string
+		containerID string
+		want        string
+		wantErr     bool
+	}{
+		{
+			name:        "docker container",
+			containerID: "4f2a9c1b7e3d",
+			want:        filepath.Join(root, dirs[0]),
+			wantErr:     false,
+		},
+		{
+			name:        "containerd container",
+			containerID: "9a8b7c6d5e4f",
+			want:        filepath.Join(root, dirs[1]),
+			wantErr:     false,
+		},
+		{
+			name:        "unknown container",
+			containerID: "000000000000",
+			want:        "",
+			wantErr:     true,
+		},
+		{
+			name:        "empty container id",
+			containerID: "",
+			want:        "",
+			wantErr:     true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := FindCgroup(root, tt.containerID)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("FindCgroup() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("FindCgroup() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCgroupProcs(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "cgroup.procs"), []byte("12\n345\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	got, err := CgroupProcs(dir)
+	if err != nil {
+		t.Fatalf("CgroupProcs() error = %v", err)
+	}
+	if want := []int{12, 345}; !reflect.DeepEqual(got, want) {
+		t.Errorf("CgroupProcs() = %v, want %v", got, want)
+	}
+}
+
+func TestResolveBinary(t *testing.T) {
+	type args struct {
+		pid     int
+		binPath string
+	}
+	tests := []struct {
+		name string
+		args args
+		want string
+	}{
+		{
+			name: "absolute path",
+			args: args{
+				pid:     42,
+				binPath: "/usr/local/bin/app",
+			},
+			want: "/proc/42/root/usr/local/bin/app",
+		},
+		{
+			name: "relative path",
+			args: args{
+				pid:     42,
+				binPath: "app",
+			},
+			want: "/proc/42/root/app",
+		},
+		{
+			name: "process executable",
+			args: args{
+				pid:     42,
+				binPath: "",
+			},
+			want: "/proc/42/exe",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ResolveBinary(tt.args.pid, tt.args.binPath); got != tt.want {
+				t.Errorf("ResolveBinary() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,183 @@
+package coverage
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/alegrey91/harpoon/internal/elfreader"
+	"github.com/alegrey91/harpoon/internal/executor"
+	"golang.org/x/tools/cover"
+)
+
+// ErrPartialProfile is returned, along with the profile,
+// when some tests failed: their coverage could be missing.
+var ErrPartialProfile = errors.New("some tests failed, the coverage profile is partial")
+
+// Function is a function declared in the files of a coverage profile.
+type Function struct {
+	// Package is the import path of the package declaring the function.
+	Package string
+	// Receiver is the name of the receiver type, for the methods.
+	Receiver string
+	Name     string
+	// Covered is true when some block of the function ran.
+	Covered bool
+}
+
+// String returns the name of the function qualified by its package
+// and receiver type, eg. example.com/app/pkg.Store.Get.
+// This is the name Normalize returns for its symbol.
+func (f Function) String() string {
+	if f.Receiver != "" {
+		return f.Package + "." + f.Receiver + "." + f.Name
+	}
+	return f.Package + "." + f.Name
+}
+
+// Normalize returns the name of the function of the symbol
+// without the pointer receiver and the type arguments, eg.
+// example.com/app/pkg.(*Store[go.shape.string]).Get -> example.com/app/pkg.Store.Get.
+func Normalize(symbol string) string {
+	symbol = strings.ReplaceAll(elfreader.ElideTypeArgs(symbol), "[...]", "")
+	symbol = strings.Replace(symbol, ".(*", ".", 1)
+	return strings.Replace(symbol, ").", ".", 1)
+}
+
+// Generate runs the tests of the packages matching the patterns,
+// from the given directory, and returns their coverage profile.
+// The profile of the passing packages is returned even when some tests fail,
+// with an error wrapping ErrPartialProfile.
+func Generate(dir string, patterns []string, opts executor.BuildOptions) ([]*cover.Profile, error) {
+	profile, err := os.CreateTemp("", "harpoon-cover-")
+	if err != nil {
+		return nil, fmt.Errorf("error creating coverage profile: %w", err)
+	}
+	profile.Close()
+	defer os.Remove(profile.Name())
+
+	args := append([]string{"test", "-covermode=set", "-coverprofile=" + profile.Name()}, opts.BuildFlags()...)
+	args = append(args, patterns...)
+	cmd := opts.GoCommand(dir, args...)
+	output, runErr := cmd.CombinedOutput()
+
+	profiles, err := cover.ParseProfiles(profile.Name())
+	if runErr != nil && (err != nil || len(profiles) == 0) {
+		return nil, fmt.Errorf("failed to execute coverage command '%s': %v: %s", cmd.String(), runErr, bytes.TrimSpace(output))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading coverage profile: %w", err)
+	}
+	if runErr != nil {
+		return profiles, fmt.Errorf("%w: %v", ErrPartialProfile, runErr)
+	}
+	return profiles, nil
+}
+
+// Write writes the profiles in the format of go test -coverprofile.
+func Write(w io.Writer, profiles []*cover.Profile) error {
+	mode := "set"
+	if len(profiles) > 0 {
+		mode = profiles[0].Mode
+	}
+	if _, err := fmt.Fprintf(w, "mode: %s\n", mode); err != nil {
+		return err
+	}
+	for _, p := range profiles {
+		for _, b := range p.Blocks {
+			_, err := fmt.Fprintf(w, "%s:%d.%d,%d.%d %d %d\n", p.FileName, b.StartLine, b.StartCol, b.EndLine, b.EndCol, b.NumStmt, b.Count)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Functions returns the functions declared in the files of the profiles
+// which belong to the module, found in its directory, sorted by name.
+// The functions without blocks in the profiles are skipped.
+func Functions(profiles []*cover.Profile, modulePath, moduleDir string) ([]Function, error) {
+	var functions []Function
+	fset := token.NewFileSet()
+	for _, p := range profiles {
+		rel, ok := strings.CutPrefix(p.FileName, modulePath+"/")
+		if !ok {
+			continue
+		}
+		node, err := parser.ParseFile(fset, filepath.Join(moduleDir, filepath.FromSlash(rel)), nil, parser.SkipObjectResolution)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing covered file: %w", err)
+		}
+		for _, decl := range node.Decls {
+			fn, ok := decl.(*ast.FuncDecl)
+			if !ok || fn.Body == nil {
+				continue
+			}
+			start, end := fset.Position(fn.Pos()), fset.Position(fn.End())
+			blocks, covered := 0, false
+			for _, b := range p.Blocks {
+				if before(b.StartLine, b.StartCol, start) || before(end.Line, end.Column, position(b.EndLine, b.EndCol)) {
+					continue
+				}
+				blocks++
+				covered = covered || b.Count > 0
+			}
+			if blocks == 0 {
+				continue
+			}
+			functions = append(functions, Function{
+				Package:  path.Dir(p.FileName),
+				Receiver: receiverName(fn),
+				Name:     fn.Name.Name,
+				Covered:  covered,
+			})
+		}
+	}
+	sort.Slice(functions, func(i, j int) bool {
+		return functions[i].String() < functions[j].String()
+	})
+	return functions, nil
+}
+
+// position returns the position at the given line and column.
+func position(line, column int) token.Position {
+	return token.Position{Line: line, Column: column}
+}
+
+// before returns true when the line and column come before the position.
+func before(line, column int, pos token.Position) bool {
+	return line < pos.Line || line == pos.Line && column < pos.Column
+}
+
+// receiverName returns the name of the receiver type of the method,
+// or an empty string for the functions.
+func receiverName(fn *ast.FuncDecl) string {
+	if fn.Recv == nil || len(fn.Recv.List) == 0 {
+		return ""
+	}
+	expr := fn.Recv.List[0].Type
+	if star, ok := expr.(*ast.StarExpr); ok {
+		expr = star.X
+	}
+	// generic types, eg. Store[K, V]
+	switch index := expr.(type) {
+	case *ast.IndexExpr:
+		expr = index.X
+	case *ast.IndexListExpr:
+		expr = index.X
+	}
+	if ident, ok := expr.(*ast.Ident); ok {
+		return ident.Name
+	}
+	return ""
+}
@@ -0,0 +1,91 @@
+package coverage
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/alegrey91/harpoon/internal/executor"
+	"github.com/alegrey91/harpoon/internal/testutil"
+	"golang.org/x/tools/cover"
+)
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		symbol string
+		want   string
+	}{
+		{"example.com/app/pkg.Get", "example.com/app/pkg.Get"},
+		{"example.com/app/pkg.(*Store).Get", "example.com/app/pkg.Store.Get"},
+		{"example.com/app/pkg.Store.Get", "example.com/app/pkg.Store.Get"},
+		{"example.com/app/pkg.(*Store[...]).Get", "example.com/app/pkg.Store.Get"},
+		{"example.com/app/pkg.Map[...]", "example.com/app/pkg.Map"},
+		{"example.com/app/pkg.(*Store[go.shape.string]).Get", "example.com/app/pkg.Store.Get"},
+		{"example.com/app/pkg.Map[go.shape.int]", "example.com/app/pkg.Map"},
+	}
+	for _, tt := range tests {
+		if got := Normalize(tt.symbol); got != tt.want {
+			t.Errorf("Normalize(%q) = %q, want %q", tt.symbol, got, tt.want)
+		}
+	}
+}
+
+func TestFunctions(t *testing.T) {
+	dir := testutil.ExtractArchive(t, "testdata/functions.txtar")
+
+	profiles, err := Generate(dir, []string{"./..."}, executor.BuildOptions{})
+	if err != nil {
+		t.Fatalf("Generate() error = %v", err)
+	}
+	functions, err := Functions(profiles, "example.com/app", dir)
+	if err != nil {
+		t.Fatalf("Functions() error = %v", err)
+	}
+	want := []Function{
+		{Package: "example.com/app/store", Name: "New", Covered: true},
+		{Package: "example.com/app/store", Name: "Open", Covered: true},
+		{Package: "example.com/app/store", Receiver: "Store", Name: "Get", Covered: true},
+		{Package: "example.com/app/store", Receiver: "Store", Name: "Set"},
+	}
+	if !reflect.DeepEqual(functions, want) {
+		t.Errorf("Functions() = %+v, want %+v", functions, want)
+	}
+
+	// the files of other modules are skipped.
+	functions, err = Functions(profiles, "example.com/other", dir)
+	if err != nil || len(functions) != 0 {
+		t.Errorf("Functions() = %+v, %v, want none", functions, err)
+	}
+
+	// the profile is written back as go test does.
+	var buf bytes.Buffer
+	if err := Write(&buf, profiles); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	written, err := cover.ParseProfilesFromReader(&buf)
+	if err != nil {
+		t.Fatalf("ParseProfilesFromReader() error = %v", err)
+	}
+	if !reflect.DeepEqual(written, profiles) {
+		t.Errorf("Write() = %+v, want %+v", written, profiles)
+	}
+}
+
+func TestGenerate(t *testing.T) {
+	dir := testutil.ExtractArchive(t, "testdata/generate.txtar")
+
+	// the coverage of the failing tests is still returned.
+	profiles, err := Generate(dir, []string{"."}, executor.BuildOptions{})
+	if !errors.Is(err, ErrPartialProfile) {
+		t.Fatalf("Generate() error = %v, want %v", err, ErrPartialProfile)
+	}
+	if len(profiles) != 1 || !strings.HasSuffix(profiles[0].FileName, "app.go") {
+		t.Errorf("Generate() = %+v, want the profile of app.go", profiles)
+	}
+
+	if _, err := Generate(dir, []string{"./broken"}, executor.BuildOptions{}); err == nil {
+		t.Errorf("Generate() expected error for a package not building")
+	}
+}
@@ -6,29 +6,94 @@ import (
 	"encoding/binary"
 	"errors"
 	"fmt"
+	"os"
 	"path/filepath"
+	"slices"
+	"strings"
 	"sync"
+	"syscall"
 	"time"
 	"unsafe"
 
+	"github.com/alegrey91/harpoon/internal/container"
 	probes "github.com/alegrey91/harpoon/internal/ebpf/probesfacade"
+	"github.com/alegrey91/harpoon/internal/elfreader"
 	embedded "github.com/alegrey91/harpoon/internal/embeddable"
 	"github.com/alegrey91/harpoon/internal/executor"
+	"github.com/alegrey91/harpoon/internal/recorder"
+	"github.com/alegrey91/harpoon/internal/syscallutils"
 	bpf "github.com/aquasecurity/libbpfgo"
 )
 
 var (
 	bpfConfigMap       = "config_map"
+	bpfSettingsMap     = "settings_map"
 	bpfEventsMap       = "events"
+	readGoroutinesVar  = "read_goroutines"
 	uprobeEnterFunc    = "enter_function"
 	uprobeExitFunc     = "exit_function"
+	uprobeEnterNewproc = "enter_newproc"
+	uprobeExitNewproc  = "exit_newproc"
+	uprobeEnterGoexit  = "enter_goexit"
+	uprobeEnterTRunner = "enter_trunner"
+	newprocSymbol      = "runtime.newproc1"
+	goexitSymbol       = "runtime.goexit1"
+	tRunnerSymbol      = "testing.tRunner"
 	tracepointFunc     = "trace_syscall"
 	tracepointCategory = "raw_syscalls"
 	tracepointName     = "sys_enter"
+	deniedFunc         = "trace_denied_syscall"
+	deniedName         = "sys_exit"
+	ioUringFunc        = "trace_io_uring_submit"
+	ioUringCategory    = "io_uring"
+	ioUringName        = "io_uring_submit_req"
 )
 
+// ErrPermission is returned by InitProbes when the ebpf programs
+// can't be loaded because of missing privileges (eg. CAP_BPF, CAP_PERFMON).
+var ErrPermission = errors.New("missing privileges to load the ebpf programs")
+
+// kinds of event sent by the ebpf program.
+const (
+	eventSyscall uint32 = iota
+	eventIOUring
+	eventTestStart
+)
+
+// event mirrors the syscall_data struct of the ebpf program.
 type event struct {
+	// for io_uring events, this is the opcode of the operation.
 	SyscallID uint32
+	PID       uint32
+	TID       uint32
+	Kind      uint32
+	Timestamp uint64
+	Args      [6]uint64
+	// set only when attributing the syscalls to the tests.
+	Goroutine uint64
+}
+
+// testNameLen is the max length of the test names sent by the ebpf program.
+const testNameLen = 128
+
+// testEvent mirrors the test_data struct of the ebpf program.
+type testEvent struct {
+	SyscallID uint32
+	PID       uint32
+	TID       uint32
+	Kind      uint32
+	Timestamp uint64
+	Goroutine uint64
+	Name      [testNameLen]byte
+}
+
+// settings mirrors the settings struct of the ebpf program.
+type settings struct {
+	CgroupID         uint64
+	FollowGoroutines uint32
+	TargetPID        uint32
+	PerTest          uint32
+	TestNameOffset   uint32
 }
 
 type CaptureOptions struct {
@@ -36,27 +101,119 @@ type CaptureOptions struct {
 	CommandError  bool
 	LibbpfOutput  bool
 	Interval      int
+	// Recorder, when set, receives every raw event
+	// collected during the capture.
+	Recorder *recorder.Recorder
+	// OnEvent, when set, is called with every raw event
+	// collected during the capture, as soon as it's received.
+	OnEvent func(e recorder.Event)
+	// Variant and Run are set in the raw events: the env matrix variant
+	// and the number of the execution of the command.
+	Variant string
+	Run     int
+	// CgroupPath, when set, restricts the capture to the processes
+	// of the given cgroup (v2), instead of filtering by command name.
+	CgroupPath string
+	// AttachPID, when set, attaches to an already running process
+	// instead of executing the command.
+	AttachPID int
+	// FollowGoroutines charges to the traced function the syscalls
+	// of the goroutines it spawns, until they exit.
+	FollowGoroutines bool
+	// Stdin connects our stdin to the command.
+	Stdin bool
+	// StdoutFile and StderrFile receive the raw output of the command,
+	// "-" stands for our own stdout/stderr.
+	StdoutFile string
+	StderrFile string
+	// Credential, when set, is the user and group
+	// the command is executed as.
+	Credential *syscall.Credential
+	// Dir is the working directory of the command.
+	Dir string
+	// CleanEnv passes only the provided env variables to the command.
+	CleanEnv bool
+	// Wrapper is the command used to execute the traced command,
+	// which is appended to it (eg. to install a seccomp profile).
+	Wrapper []string
+	// TraceDenied captures the system calls failed with EPERM as well,
+	// since those denied by seccomp are not visible on sys_enter.
+	TraceDenied bool
+	// Isolate executes the command in new mount, network, pid
+	// and ipc namespaces, filtering its events by pid.
+	Isolate bool
+	// PerTest attributes the syscalls to the tests (and subtests)
+	// running them, when the command is a test binary.
+	PerTest bool
 }
 
 type EbpfSetup struct {
-	mod      *bpf.Module
-	link     *bpf.BPFLink
-	pb       *bpf.PerfBuffer
-	eventsCh chan []byte
-	lostCh   chan uint64
-	opts     CaptureOptions
-	cmd      []string
-	env      []string
+	mod         *bpf.Module
+	link        *bpf.BPFLink
+	deniedLink  *bpf.BPFLink
+	ioUringLink *bpf.BPFLink
+	pb          *bpf.PerfBuffer
+	eventsCh    chan []byte
+	lostCh      chan uint64
+	opts        CaptureOptions
+	symbol      string
+	cmd         []string
+	env         []string
+
+	flushCh chan struct{}
+
+	settingsMap *bpf.BPFMap
+	settings    settings
+
+	mu         sync.Mutex
+	ioUringOps []string
+	cmdErr     error
+	// tests maps the goroutines to the tests they run,
+	// testSyscalls the tests to their syscalls.
+	tests        map[uint64]string
+	testSyscalls map[string][]uint32
 }
 
 // InitProbes setup the ebpf module attaching probes and tracepoints
 // to the ebpf program.
 // Returns the ebpfSetup struct in case of seccess, an error in case of failure.
 func InitProbes(functionSymbol string, cmdArgs []string, env []string, opts CaptureOptions) (*EbpfSetup, error) {
-	if len(cmdArgs) == 0 {
+	if len(cmdArgs) == 0 && opts.AttachPID == 0 {
 		return nil, errors.New("error no arguments provided, at least 1 argument is required")
 	}
 
+	// binPath is the path of the binary as seen from the host,
+	// comm is the command name we expect to see from the ebpf program.
+	var binPath, comm string
+	if opts.AttachPID > 0 {
+		// the process could live in a different mount namespace,
+		// so we resolve its binary through /proc/<pid>/root.
+		var arg0 string
+		if len(cmdArgs) > 0 {
+			arg0 = cmdArgs[0]
+		}
+		binPath = container.ResolveBinary(opts.AttachPID, arg0)
+		procComm, err := container.Comm(opts.AttachPID)
+		if err != nil {
+			return nil, fmt.Errorf("error attaching to process %d: %v", opts.AttachPID, err)
+		}
+		comm = procComm
+	} else {
+		binPath = cmdArgs[0]
+		// the command could be executed from a different working
+		// directory, so we make sure both the probes and the
+		// command refer to the same binary.
+		if strings.Contains(binPath, "/") && !filepath.IsAbs(binPath) {
+			absPath, err := filepath.Abs(binPath)
+			if err != nil {
+				return nil, fmt.Errorf("error resolving path of %s: %v", binPath, err)
+			}
+			binPath = absPath
+			cmdArgs = append([]string{binPath}, cmdArgs[1:]...)
+		}
+		comm = filepath.Base(cmdArgs[0])
+	}
+
 	if !opts.LibbpfOutput {
 		// suppress libbpf log ouput
 		bpf.SetLoggerCbs(
@@ -95,32 +252,130 @@ func InitProbes(functionSymbol string, cmdArgs []string, env []string, opts Capt
 		return nil, fmt.Errorf("error loading program (%s): %v", tracepointFunc, err)
 	}
 
-	bpfModule.BPFLoadObject()
-	offset, err := probes.AttachUProbe(cmdArgs[0], functionSymbol, enterFuncProbe)
+	tRunnerProbe, err := bpfModule.GetProgram(uprobeEnterTRunner)
+	if err != nil {
+		return nil, fmt.Errorf("error loading program (%s): %v", uprobeEnterTRunner, err)
+	}
+	if !opts.PerTest {
+		tRunnerProbe.SetAutoload(false)
+	}
+
+	deniedFunction, err := bpfModule.GetProgram(deniedFunc)
+	if err != nil {
+		return nil, fmt.Errorf("error loading program (%s): %v", deniedFunc, err)
+	}
+	if !opts.TraceDenied {
+		deniedFunction.SetAutoload(false)
+	}
+
+	ioUringFunction, err := bpfModule.GetProgram(ioUringFunc)
+	if err != nil {
+		return nil, fmt.Errorf("error loading program (%s): %v", ioUringFunc, err)
+	}
+	// the io_uring tracepoint is not available on older kernels
+	// (or when io_uring is disabled), so we don't load its program.
+	ioUringSupported := tracepointExists(ioUringCategory, ioUringName)
+	if !ioUringSupported {
+		ioUringFunction.SetAutoload(false)
+	}
+
+	// the programs read the goroutine of the syscalls only when needed,
+	// so that the older kernels can load them (see read_goroutines).
+	if opts.FollowGoroutines || opts.PerTest {
+		if err := bpfModule.InitGlobalVariable(readGoroutinesVar, uint32(1)); err != nil {
+			return nil, fmt.Errorf("error setting variable (%s): %v", readGoroutinesVar, err)
+		}
+	}
+	if err := bpfModule.BPFLoadObject(); err != nil {
+		if errors.Is(err, syscall.EPERM) || errors.Is(err, syscall.EACCES) {
+			return nil, fmt.Errorf("%w: %v", ErrPermission, err)
+		}
+		return nil, fmt.Errorf("error loading BPF object: %v", err)
+	}
+	offset, err := probes.AttachUProbe(binPath, functionSymbol, enterFuncProbe)
 	if err != nil {
 		return nil, fmt.Errorf("error attaching uprobe to %s: %v", functionSymbol, err)
 	}
 
-	err = probes.AttachURETProbe(cmdArgs[0], functionSymbol, exitFuncProbe, offset)
+	err = probes.AttachURETProbe(binPath, functionSymbol, exitFuncProbe, offset)
 	if err != nil {
 		return nil, fmt.Errorf("error attaching uretprobe to %s: %v", functionSymbol, err)
 	}
 
+	if opts.FollowGoroutines {
+		if err := attachGoroutineProbes(bpfModule, binPath); err != nil {
+			return nil, err
+		}
+	}
+
+	var testNameOffset uint64
+	if opts.PerTest {
+		testNameOffset, err = elfreader.TestNameOffset(binPath)
+		if err != nil {
+			return nil, fmt.Errorf("error looking up test names in %s: %v", binPath, err)
+		}
+		if _, err := probes.AttachUProbe(binPath, tRunnerSymbol, tRunnerProbe); err != nil {
+			return nil, fmt.Errorf("error attaching uprobe to %s: %v", tRunnerSymbol, err)
+		}
+	}
+
 	traceLink, err := traceFunction.AttachTracepoint(tracepointCategory, tracepointName)
 	if err != nil {
 		return nil, fmt.Errorf("error attaching tracepoint at event (%s:%s): %v", tracepointCategory, tracepointName, err)
 	}
 
+	var deniedLink *bpf.BPFLink
+	if opts.TraceDenied {
+		deniedLink, err = deniedFunction.AttachTracepoint(tracepointCategory, deniedName)
+		if err != nil {
+			return nil, fmt.Errorf("error attaching tracepoint at event (%s:%s): %v", tracepointCategory, deniedName, err)
+		}
+	}
+
+	var ioUringLink *bpf.BPFLink
+	if ioUringSupported {
+		ioUringLink, err = ioUringFunction.AttachTracepoint(ioUringCategory, ioUringName)
+		if err != nil {
+			return nil, fmt.Errorf("error attaching tracepoint at event (%s:%s): %v", ioUringCategory, ioUringName, err)
+		}
+	}
+
 	/*
 		Sending input argument to BPF program
 		to instruct tracing specific args taken from cli.
 	*/
 	config_key_args := 0
-	baseargs := filepath.Base(cmdArgs[0])
-	baseCmd := append([]byte(baseargs), 0)
+	baseCmd := append([]byte(comm), 0)
 	err = config.Update(unsafe.Pointer(&config_key_args), unsafe.Pointer(&baseCmd[0]))
 	if err != nil {
-		return nil, fmt.Errorf("error updating map (%s) with values %d / %s: %v", bpfConfigMap, config_key_args, baseargs, err)
+		return nil, fmt.Errorf("error updating map (%s) with values %d / %s: %v", bpfConfigMap, config_key_args, comm, err)
+	}
+
+	/*
+		Sending settings to BPF program.
+	*/
+	var st settings
+	if opts.FollowGoroutines {
+		st.FollowGoroutines = 1
+	}
+	if opts.PerTest {
+		st.PerTest = 1
+		st.TestNameOffset = uint32(testNameOffset)
+	}
+	if opts.CgroupPath != "" {
+		st.CgroupID, err = container.CgroupID(opts.CgroupPath)
+		if err != nil {
+			return nil, fmt.Errorf("error getting cgroup id: %v", err)
+		}
+	}
+	settingsMap, err := bpfModule.GetMap(bpfSettingsMap)
+	if err != nil {
+		return nil, fmt.Errorf("error retrieving map (%s) from BPF program: %v", bpfSettingsMap, err)
+	}
+	settingsKey := uint32(0)
+	err = settingsMap.Update(unsafe.Pointer(&settingsKey), unsafe.Pointer(&st))
+	if err != nil {
+		return nil, fmt.Errorf("error updating map (%s): %v", bpfSettingsMap, err)
 	}
 
 	// init perf buffer
@@ -132,26 +387,99 @@ func InitProbes(functionSymbol string, cmdArgs []string, env []string, opts Capt
 	}
 
 	return &EbpfSetup{
-		mod:      bpfModule,
-		link:     traceLink,
-		pb:       pb,
-		eventsCh: eventsChannel,
-		lostCh:   lostChannel,
-		opts:     opts,
-		cmd:      cmdArgs,
-		env:      env,
+		mod:         bpfModule,
+		link:        traceLink,
+		deniedLink:  deniedLink,
+		ioUringLink: ioUringLink,
+		pb:          pb,
+		eventsCh:    eventsChannel,
+		lostCh:      lostChannel,
+		opts:        opts,
+		symbol:      functionSymbol,
+		cmd:         cmdArgs,
+		env:         env,
+		flushCh:     make(chan struct{}, 1),
+		settingsMap: settingsMap,
+		settings:    st,
+
+		tests:        make(map[uint64]string),
+		testSyscalls: make(map[string][]uint32),
 	}, nil
 }
 
+// attachGoroutineProbes attaches the probes needed to follow
+// the goroutines spawned by the traced function.
+func attachGoroutineProbes(bpfModule *bpf.Module, binPath string) error {
+	enterNewprocProbe, err := bpfModule.GetProgram(uprobeEnterNewproc)
+	if err != nil {
+		return fmt.Errorf("error loading program (%s): %v", uprobeEnterNewproc, err)
+	}
+	exitNewprocProbe, err := bpfModule.GetProgram(uprobeExitNewproc)
+	if err != nil {
+		return fmt.Errorf("error loading program (%s): %v", uprobeExitNewproc, err)
+	}
+	enterGoexitProbe, err := bpfModule.GetProgram(uprobeEnterGoexit)
+	if err != nil {
+		return fmt.Errorf("error loading program (%s): %v", uprobeEnterGoexit, err)
+	}
+
+	offset, err := probes.AttachUProbe(binPath, newprocSymbol, enterNewprocProbe)
+	if err != nil {
+		return fmt.Errorf("error attaching uprobe to %s: %v", newprocSymbol, err)
+	}
+	err = probes.AttachURETProbe(binPath, newprocSymbol, exitNewprocProbe, offset)
+	if err != nil {
+		return fmt.Errorf("error attaching uretprobe to %s: %v", newprocSymbol, err)
+	}
+	_, err = probes.AttachUProbe(binPath, goexitSymbol, enterGoexitProbe)
+	if err != nil {
+		return fmt.Errorf("error attaching uprobe to %s: %v", goexitSymbol, err)
+	}
+	return nil
+}
+
 // Close closes the ebpf link and module.
 func (ebpf *EbpfSetup) Close() {
 	ebpf.link.Destroy()
+	if ebpf.deniedLink != nil {
+		ebpf.deniedLink.Destroy()
+	}
+	if ebpf.ioUringLink != nil {
+		ebpf.ioUringLink.Destroy()
+	}
 	ebpf.mod.Close()
 }
 
+// IOUringOps returns the io_uring operations submitted
+// by the traced function, without duplicates.
+func (ebpf *EbpfSetup) IOUringOps() []string {
+	ebpf.mu.Lock()
+	defer ebpf.mu.Unlock()
+	return slices.Clone(ebpf.ioUringOps)
+}
+
+// CommandErr returns the error of the traced command
+// (eg. *exec.ExitError), once the capture is completed.
+func (ebpf *EbpfSetup) CommandErr() error {
+	ebpf.mu.Lock()
+	defer ebpf.mu.Unlock()
+	return ebpf.cmdErr
+}
+
+// Flush asks the running capture to send the syscalls
+// collected so far, without waiting for the interval.
+func (ebpf *EbpfSetup) Flush() {
+	select {
+	case ebpf.flushCh <- struct{}{}:
+	default:
+		// a flush is already pending.
+	}
+}
+
 // Capture collects syscalls from the executed command.
 // Returns values through the given channels.
-// When the interval is 0, automatically closes the channels.
+// When the context is done, the command is stopped
+// and the collected syscalls are sent before closing the channels.
 func (ebpf *EbpfSetup) Capture(ctx context.Context, resultCh chan []uint32, errorCh chan error) {
 	// setting up ticker to dump results
 	// every interval of time.
@@ -168,26 +496,64 @@ func (ebpf *EbpfSetup) Capture(ctx context.Context, resultCh chan []uint32, erro
 	ticker = time.NewTicker(interval)
 	defer ticker.Stop()
 
+	ebpf.recordRunStart()
 	var wg sync.WaitGroup
 	wg.Add(1)
 	cmdStdoutCh := make(chan string)
 	cmdStderrCh := make(chan string)
-	// running command to trace its syscalls
-	go executor.Run(
-		ebpf.cmd,
-		ebpf.env,
-		ebpf.opts.CommandOutput,
-		ebpf.opts.CommandError,
-		&wg,
-		cmdStdoutCh,
-		cmdStderrCh,
-	)
+	if ebpf.opts.AttachPID > 0 {
+		// the process is already running,
+		// we just wait for its end.
+		go func() {
+			defer wg.Done()
+			executor.Wait(ctx, ebpf.opts.AttachPID)
+		}()
+	} else {
+		// running command to trace its syscalls
+		go func() {
+			defer wg.Done()
+			err := executor.Run(
+				ctx,
+				ebpf.cmd,
+				executor.RunOptions{
+					Env:           ebpf.env,
+					CommandOutput: ebpf.opts.CommandOutput,
+					CommandError:  ebpf.opts.CommandError,
+					CgroupPath:    ebpf.opts.CgroupPath,
+					Stdin:         ebpf.opts.Stdin,
+					StdoutFile:    ebpf.opts.StdoutFile,
+					StderrFile:    ebpf.opts.StderrFile,
+					Credential:    ebpf.opts.Credential,
+					Dir:           ebpf.opts.Dir,
+					CleanEnv:      ebpf.opts.CleanEnv,
+					Wrapper:       ebpf.opts.Wrapper,
+					Isolate:       ebpf.opts.Isolate,
+					OnStart:       ebpf.onStart,
+				},
+				cmdStdoutCh,
+				cmdStderrCh,
+			)
+			ebpf.mu.Lock()
+			ebpf.cmdErr = err
+			ebpf.mu.Unlock()
+		}()
+	}
 
 	var syscalls []uint32
+	done := make(chan struct{})
+	loopDone := make(chan struct{})
 	go func() {
+		defer close(loopDone)
+		stdoutCh, stderrCh := cmdStdoutCh, cmdStderrCh
 		for {
 			select {
-			case data := <-ebpf.eventsCh:
+			case <-done:
+				return
+			case data, ok := <-ebpf.eventsCh:
+				if !ok {
+					// the perf buffer has been stopped.
+					return
+				}
 				var e event
 				err := binary.Read(bytes.NewBuffer(data), binary.LittleEndian, &e)
 				if err != nil {
@@ -195,7 +561,25 @@ func (ebpf *EbpfSetup) Capture(ctx context.Context, resultCh chan []uint32, erro
 					// will be left empty for now.
 					return
 				}
+				if e.Kind == eventTestStart {
+					var te testEvent
+					if err := binary.Read(bytes.NewBuffer(data), binary.LittleEndian, &te); err != nil {
+						return
+					}
+					ebpf.startTest(te)
+					break
+				}
+				if ebpf.opts.Recorder != nil || ebpf.opts.OnEvent != nil {
+					ebpf.record(e)
+				}
+				if e.Kind == eventIOUring {
+					ebpf.addIOUringOp(syscallutils.IOUringOpName(e.SyscallID))
+					break
+				}
 				syscalls = append(syscalls, e.SyscallID)
+				if ebpf.opts.PerTest {
+					ebpf.addTestSyscall(e)
+				}
 			case <-ticker.C:
 				// used to send incremental result
 				// every interval of time.
@@ -204,20 +588,28 @@ func (ebpf *EbpfSetup) Capture(ctx context.Context, resultCh chan []uint32, erro
 				// to the channel, so on the next iteration
 				// this will have only the most recent values.
 				syscalls = nil
-			case _ = <-ebpf.lostCh:
+			case <-ebpf.flushCh:
+				// same as above, but on demand.
+				resultCh <- syscalls
+				syscalls = nil
+			case _, ok := <-ebpf.lostCh:
 				// managing errors from libbpf
 				// will be left empty for now.
 				//fmt.Fprintf(os.Stderr, "lost %d data\n", lost)
-				return
-			case line, ok := <-cmdStdoutCh:
+				if !ok {
+					return
+				}
+			case line, ok := <-stdoutCh:
 				// managing stdout from executed command
 				if !ok {
+					stdoutCh = nil
 					break
 				}
 				fmt.Println("stdout:", line)
-			case err, ok := <-cmdStderrCh:
+			case err, ok := <-stderrCh:
 				// managing stderr from executed command
 				if !ok {
+					stderrCh = nil
 					break
 				}
 				fmt.Println("stderr:", err)
@@ -231,6 +623,8 @@ func (ebpf *EbpfSetup) Capture(ctx context.Context, resultCh chan []uint32, erro
 	close(cmdStdoutCh)
 	close(cmdStderrCh)
 	ebpf.pb.Stop()
+	close(done)
+	<-loopDone
 
 	// sending last remained syscalls
 	// and close the channel.
@@ -238,3 +632,129 @@ func (ebpf *EbpfSetup) Capture(ctx context.Context, resultCh chan []uint32, erro
 	close(resultCh)
 	close(errorCh)
 }
+
+// addIOUringOp takes note of the io_uring operation.
+func (ebpf *EbpfSetup) addIOUringOp(op string) {
+	ebpf.mu.Lock()
+	defer ebpf.mu.Unlock()
+	if !slices.Contains(ebpf.ioUringOps, op) {
+		ebpf.ioUringOps = append(ebpf.ioUringOps, op)
+	}
+}
+
+// TestSyscalls returns the syscalls of the traced function
+// made by each test (or subtest), without duplicates.
+// The syscalls made outside of the tests goroutines are not included.
+func (ebpf *EbpfSetup) TestSyscalls() map[string][]uint32 {
+	ebpf.mu.Lock()
+	defer ebpf.mu.Unlock()
+	tests := make(map[string][]uint32, len(ebpf.testSyscalls))
+	for name, syscalls := range ebpf.testSyscalls {
+		tests[name] = slices.Clone(syscalls)
+	}
+	return tests
+}
+
+// startTest keeps track of the test running in the goroutine.
+// Goroutines are reused, so the test replaces the previous one, if any.
+func (ebpf *EbpfSetup) startTest(te testEvent) {
+	name := string(bytes.TrimRight(te.Name[:], "\x00"))
+	ebpf.mu.Lock()
+	defer ebpf.mu.Unlock()
+	ebpf.tests[te.Goroutine] = name
+}
+
+// testOf returns the test running in the goroutine, if any.
+func (ebpf *EbpfSetup) testOf(goroutine uint64) string {
+	ebpf.mu.Lock()
+	defer ebpf.mu.Unlock()
+	return ebpf.tests[goroutine]
+}
+
+// addTestSyscall attributes the syscall to the test running in its goroutine.
+// The goroutines spawned by the tests are not tracked,
+// so their syscalls are not attributed to any test.
+func (ebpf *EbpfSetup) addTestSyscall(e event) {
+	ebpf.mu.Lock()
+	defer ebpf.mu.Unlock()
+	name, ok := ebpf.tests[e.Goroutine]
+	if !ok {
+		return
+	}
+	if !slices.Contains(ebpf.testSyscalls[name], e.SyscallID) {
+		ebpf.testSyscalls[name] = append(ebpf.testSyscalls[name], e.SyscallID)
+	}
+}
+
+// onStart filters the events by the pid of the command, once started,
+// when it runs in a new pid namespace.
+// The pid is the one seen from the host, like in the ebpf program.
+func (ebpf *EbpfSetup) onStart(pid int) error {
+	if !ebpf.opts.Isolate {
+		return nil
+	}
+	st := ebpf.settings
+	st.TargetPID = uint32(pid)
+	settingsKey := uint32(0)
+	if err := ebpf.settingsMap.Update(unsafe.Pointer(&settingsKey), unsafe.Pointer(&st)); err != nil {
+		return fmt.Errorf("error updating map (%s): %v", bpfSettingsMap, err)
+	}
+	return nil
+}
+
+// tracepointExists returns true if the kernel exposes the given tracepoint.
+func tracepointExists(category, name string) bool {
+	for _, tracefs := range []string{"/sys/kernel/tracing", "/sys/kernel/debug/tracing"} {
+		if _, err := os.Stat(filepath.Join(tracefs, "events", category, name)); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// recordRunStart records the start of the run, before its events,
+// so that it's replayed even when the traced function makes no system calls.
+func (ebpf *EbpfSetup) recordRunStart() {
+	if ebpf.opts.Recorder == nil {
+		return
+	}
+	re := recorder.Event{
+		Kind:    recorder.KindRunStart,
+		Symbol:  ebpf.symbol,
+		Variant: ebpf.opts.Variant,
+		Run:     ebpf.opts.Run,
+		PerTest: ebpf.opts.PerTest,
+	}
+	if err := ebpf.opts.Recorder.Record(re); err != nil {
+		fmt.Fprintf(os.Stderr, "error recording event: %v\n", err)
+	}
+}
+
+// record passes the raw event to the configured recorder and callback.
+func (ebpf *EbpfSetup) record(e event) {
+	var kind string
+	if e.Kind == eventIOUring {
+		kind = recorder.KindIOUring
+	}
+	re := recorder.Event{
+		Kind:      kind,
+		Symbol:    ebpf.symbol,
+		PID:       e.PID,
+		TID:       e.TID,
+		Timestamp: e.Timestamp,
+		SyscallID: e.SyscallID,
+		Args:      e.Args[:],
+		Test:      ebpf.testOf(e.Goroutine),
+		Variant:   ebpf.opts.Variant,
+		Run:       ebpf.opts.Run,
+	}
+	if ebpf.opts.OnEvent != nil {
+		ebpf.opts.OnEvent(re)
+	}
+	if ebpf.opts.Recorder == nil {
+		return
+	}
+	if err := ebpf.opts.Recorder.Record(re); err != nil {
+		fmt.Fprintf(os.Stderr, "error recording event: %v\n", err)
+	}
+}
@@ -0,0 +1,38 @@
+package elfreader
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// buildIDSection is the section of the ELF note
+// holding the build ID set by the go linker.
+const buildIDSection = ".note.go.buildid"
+
+// BuildID returns the Go build ID of the binary.
+func (e *ElfReader) BuildID() (string, error) {
+	section := e.file.Section(buildIDSection)
+	if section == nil {
+		return "", fmt.Errorf("missing %s section", buildIDSection)
+	}
+	data, err := section.Data()
+	if err != nil {
+		return "", fmt.Errorf("error reading %s section: %v", buildIDSection, err)
+	}
+	// the note is made of the size of the name and of the description,
+	// the type, then the name ("Go") and the description (the build ID),
+	// both padded to 4 bytes.
+	if len(data) < 12 {
+		return "", fmt.Errorf("invalid %s section", buildIDSection)
+	}
+	nameSize := uint64(e.file.ByteOrder.Uint32(data[0:4]))
+	descSize := uint64(e.file.ByteOrder.Uint32(data[4:8]))
+	descStart := 12 + (nameSize+3)&^3
+	if descStart+descSize > uint64(len(data)) {
+		return "", fmt.Errorf("invalid %s section", buildIDSection)
+	}
+	if name := bytes.TrimRight(data[12:12+nameSize], "\x00"); string(name) != "Go" {
+		return "", fmt.Errorf("invalid %s section: unexpected note name %q", buildIDSection, name)
+	}
+	return string(data[descStart : descStart+descSize]), nil
+}
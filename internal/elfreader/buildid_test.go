@@ -0,0 +1,32 @@
+package elfreader
+
+import (
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+func TestBuildID(t *testing.T) {
+	exe, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	output, err := exec.Command("go", "tool", "buildid", exe).Output()
+	if err != nil {
+		t.Skipf("go tool buildid not available: %v", err)
+	}
+	reader, err := NewElfReader(exe)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+
+	got, err := reader.BuildID()
+	if err != nil {
+		t.Fatalf("BuildID() error = %v", err)
+	}
+	if want := strings.TrimSpace(string(output)); got != want {
+		t.Errorf("BuildID() = %q, want %q", got, want)
+	}
+}
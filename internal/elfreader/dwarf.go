@@ -0,0 +1,54 @@
+package elfreader
+
+import (
+	"debug/dwarf"
+	"fmt"
+)
+
+// FieldOffset returns the offset of the field within the struct type,
+// as described by the DWARF data of the ELF file.
+// It's used to read the fields of Go structs from the ebpf program.
+func (e *ElfReader) FieldOffset(structName, fieldName string) (uint64, error) {
+	data, err := e.file.DWARF()
+	if err != nil {
+		return 0, fmt.Errorf("error reading DWARF data: %v", err)
+	}
+
+	reader := data.Reader()
+	for {
+		entry, err := reader.Next()
+		if err != nil {
+			return 0, fmt.Errorf("error reading DWARF entry: %v", err)
+		}
+		if entry == nil {
+			break
+		}
+		if entry.Tag != dwarf.TagStructType || entry.Val(dwarf.AttrName) != structName {
+			continue
+		}
+		if !entry.Children {
+			continue
+		}
+		// look for the field among the members of the struct.
+		for {
+			member, err := reader.Next()
+			if err != nil {
+				return 0, fmt.Errorf("error reading DWARF entry: %v", err)
+			}
+			if member == nil || member.Tag == 0 {
+				break
+			}
+			if member.Tag != dwarf.TagMember || member.Val(dwarf.AttrName) != fieldName {
+				reader.SkipChildren()
+				continue
+			}
+			offset, ok := member.Val(dwarf.AttrDataMemberLoc).(int64)
+			if !ok {
+				return 0, fmt.Errorf("missing offset of field %s.%s", structName, fieldName)
+			}
+			return uint64(offset), nil
+		}
+		return 0, fmt.Errorf("field %s not found in struct %s", fieldName, structName)
+	}
+	return 0, fmt.Errorf("struct %s not found", structName)
+}
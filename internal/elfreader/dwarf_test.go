@@ -0,0 +1,112 @@
+package elfreader
+
+import (
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestFieldOffset(t *testing.T) {
+	// the test binary itself is used as ELF file,
+	// comparing the offsets with the ones known by the runtime.
+	exe, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	reader, err := NewElfReader(exe)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+	// go test strips the DWARF data, unless the binary is kept (-c, -o).
+	if _, err := reader.file.DWARF(); err != nil {
+		t.Skipf("test binary without DWARF data: %v", err)
+	}
+
+	common, ok := reflect.TypeOf(testing.T{}).FieldByName("common")
+	if !ok {
+		t.Fatal("testing.T has no common field")
+	}
+	name, ok := common.Type.FieldByName("name")
+	if !ok {
+		t.Fatal("testing.common has no name field")
+	}
+
+	tests := []struct {
+		name       string
+		structName string
+		fieldName  string
+		want       uint64
+		wantErr    bool
+	}{
+		{
+			name:       "existing field",
+			structName: "testing.common",
+			fieldName:  "name",
+			want:       uint64(name.Offset),
+			wantErr:    false,
+		},
+		{
+			name:       "missing field",
+			structName: "testing.common",
+			fieldName:  "nonexistent",
+			want:       0,
+			wantErr:    true,
+		},
+		{
+			name:       "missing struct",
+			structName: "testing.nonexistent",
+			fieldName:  "name",
+			want:       0,
+			wantErr:    true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := reader.FieldOffset(tt.structName, tt.fieldName)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("FieldOffset() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("FieldOffset() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTestNameOffset(t *testing.T) {
+	exe, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// go test strips the DWARF data, so the offset
+	// is looked up by the release of the running toolchain.
+	common, _ := reflect.TypeOf(testing.T{}).FieldByName("common")
+	name, _ := common.Type.FieldByName("name")
+	got, err := TestNameOffset(exe)
+	if err != nil {
+		t.Fatalf("TestNameOffset() error = %v", err)
+	}
+	if got != uint64(name.Offset) {
+		t.Errorf("TestNameOffset() = %v, want %v", got, name.Offset)
+	}
+}
+
+func TestGoRelease(t *testing.T) {
+	tests := []struct {
+		version string
+		want    string
+	}{
+		{"go1.23.4", "go1.23"},
+		{"go1.23", "go1.23"},
+		{"go1.23 X:rangefunc", "go1.23"},
+		{"go1.24rc1", "go1.24rc1"},
+		{"devel", "devel"},
+	}
+	for _, tt := range tests {
+		if got := goRelease(tt.version); got != tt.want {
+			t.Errorf("goRelease(%q) = %q, want %q", tt.version, got, tt.want)
+		}
+	}
+}
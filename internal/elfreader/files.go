@@ -0,0 +1,38 @@
+package elfreader
+
+import (
+	"debug/gosym"
+	"fmt"
+)
+
+// SymbolFiles returns the source files declaring the functions
+// of the symbols, as recorded in the line table of the binary.
+// The symbols not found in the line table are skipped.
+func (e *ElfReader) SymbolFiles(symbols []string) (map[string]string, error) {
+	pclntab := e.file.Section(".gopclntab")
+	text := e.file.Section(".text")
+	if pclntab == nil || text == nil {
+		return nil, fmt.Errorf("missing .gopclntab or .text section")
+	}
+	data, err := pclntab.Data()
+	if err != nil {
+		return nil, fmt.Errorf("error reading .gopclntab section: %v", err)
+	}
+	// since go1.3 the symbol table is empty, the line table is enough.
+	table, err := gosym.NewTable(nil, gosym.NewLineTable(data, text.Addr))
+	if err != nil {
+		return nil, fmt.Errorf("error reading line table: %v", err)
+	}
+
+	files := make(map[string]string)
+	for _, symbol := range symbols {
+		fn := table.LookupFunc(symbol)
+		if fn == nil {
+			continue
+		}
+		if file, _, _ := table.PCToLine(fn.Entry); file != "" {
+			files[symbol] = file
+		}
+	}
+	return files, nil
+}
@@ -0,0 +1,31 @@
+package elfreader
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSymbolFiles(t *testing.T) {
+	exe, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	reader, err := NewElfReader(exe)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+
+	const symbol = "github.com/alegrey91/harpoon/internal/elfreader.(*ElfReader).SymbolFiles"
+	files, err := reader.SymbolFiles([]string{symbol, "example.com/missing.Function"})
+	if err != nil {
+		t.Fatalf("SymbolFiles() error = %v", err)
+	}
+	if got := filepath.Base(files[symbol]); got != "files.go" {
+		t.Errorf("SymbolFiles()[%q] = %q, want files.go", symbol, files[symbol])
+	}
+	if len(files) != 1 {
+		t.Errorf("SymbolFiles() = %v, want only %q", files, symbol)
+	}
+}
@@ -76,3 +76,27 @@ func isGoroutine(s string) bool {
 func isTestFunction(s string) bool {
 	return reTestFunction.MatchString(s)
 }
+
+// ElideTypeArgs replaces the type arguments of the generic functions
+// and types in the symbol with "[...]", as the runtime prints them,
+// eg. pkg.(*Store[go.shape.string]).Get -> pkg.(*Store[...]).Get.
+// The linker names the generic functions after their shapes,
+// so a function can have many symbols with the same elided name.
+func ElideTypeArgs(symbol string) string {
+	var b strings.Builder
+	depth := 0
+	for _, r := range symbol {
+		switch {
+		case r == '[':
+			if depth == 0 {
+				b.WriteString("[...]")
+			}
+			depth++
+		case r == ']' && depth > 0:
+			depth--
+		case depth == 0:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
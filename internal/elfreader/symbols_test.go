@@ -97,3 +97,21 @@ func Test_isTestFunction(t *testing.T) {
 		})
 	}
 }
+
+func TestElideTypeArgs(t *testing.T) {
+	tests := []struct {
+		symbol string
+		want   string
+	}{
+		{"example.com/app/pkg.Get", "example.com/app/pkg.Get"},
+		{"example.com/app/pkg.First[go.shape.int]", "example.com/app/pkg.First[...]"},
+		{"example.com/app/pkg.(*Store[go.shape.string]).Get", "example.com/app/pkg.(*Store[...]).Get"},
+		{"example.com/app/pkg.Keys[go.shape.map[string]int,go.shape.int].func1", "example.com/app/pkg.Keys[...].func1"},
+		{"example.com/app/pkg.(*Store[...]).Get", "example.com/app/pkg.(*Store[...]).Get"},
+	}
+	for _, tt := range tests {
+		if got := ElideTypeArgs(tt.symbol); got != tt.want {
+			t.Errorf("ElideTypeArgs(%q) = %q, want %q", tt.symbol, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package elfreader
+
+import (
+	"debug/buildinfo"
+	"fmt"
+	"strings"
+)
+
+// testNameOffsets holds the offset of the name field of testing.common
+// by Go release, on the 64-bit architectures.
+// The struct is internal, so it can change from one release to another.
+var testNameOffsets = map[string]uint64{
+	"go1.20": 256,
+	"go1.21": 256,
+	"go1.22": 248,
+	"go1.23": 248,
+	"go1.24": 248,
+	"go1.25": 256,
+	"go1.26": 288,
+	"go1.27": 288,
+}
+
+// TestNameOffset returns the offset of the name field of testing.common
+// within the test binary, to read the name of the running tests.
+// It's found in the DWARF data, when available. Otherwise (eg. built with
+// -ldflags=-w) it's looked up by the Go release the binary is built with.
+func TestNameOffset(binPath string) (uint64, error) {
+	reader, err := NewElfReader(binPath)
+	if err != nil {
+		return 0, err
+	}
+	defer reader.Close()
+	offset, err := reader.FieldOffset("testing.common", "name")
+	if err == nil {
+		return offset, nil
+	}
+
+	info, infoErr := buildinfo.ReadFile(binPath)
+	if infoErr != nil {
+		return 0, fmt.Errorf("%v, and the Go version is unknown: %v", err, infoErr)
+	}
+	offset, ok := testNameOffsets[goRelease(info.GoVersion)]
+	if !ok {
+		return 0, fmt.Errorf("%v, and the layout of the testing package of %s is unknown: keep the DWARF data (no -ldflags=-w)", err, info.GoVersion)
+	}
+	return offset, nil
+}
+
+// goRelease returns the release of the Go version,
+// without the minor revision and the experiments, eg. go1.23 for go1.23.4.
+func goRelease(version string) string {
+	version, _, _ = strings.Cut(version, " ")
+	major, minor, found := strings.Cut(version, ".")
+	if !found {
+		return version
+	}
+	minor, _, _ = strings.Cut(minor, ".")
+	return major + "." + minor
+}
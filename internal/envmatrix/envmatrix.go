@@ -0,0 +1,70 @@
+package envmatrix
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Variant is a runtime configuration the command is executed with.
+// Its name is used as the directory where the results are stored.
+type Variant struct {
+	Name string   `yaml:"name"`
+	Env  []string `yaml:"env"`
+}
+
+// Matrix is the list of variants defined in the env matrix file, eg:
+//
+//	variants:
+//	  - name: single-proc
+//	    env:
+//	      - GOMAXPROCS=1
+//	  - name: cgo-resolver
+//	    env:
+//	      - GODEBUG=netdns=cgo
+type Matrix struct {
+	Variants []Variant `yaml:"variants"`
+}
+
+// Load reads the matrix from the given file.
+func Load(path string) (*Matrix, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading env matrix %s: %v", path, err)
+	}
+	matrix, err := Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing env matrix %s: %v", path, err)
+	}
+	return matrix, nil
+}
+
+// Parse parses and validates the matrix.
+func Parse(data []byte) (*Matrix, error) {
+	var matrix Matrix
+	if err := yaml.UnmarshalStrict(data, &matrix); err != nil {
+		return nil, err
+	}
+	if len(matrix.Variants) == 0 {
+		return nil, fmt.Errorf("no variants defined")
+	}
+
+	names := make(map[string]bool)
+	for _, v := range matrix.Variants {
+		if v.Name == "" || v.Name == "." || v.Name == ".." || strings.ContainsRune(v.Name, os.PathSeparator) {
+			return nil, fmt.Errorf("invalid variant name %q", v.Name)
+		}
+		if names[v.Name] {
+			return nil, fmt.Errorf("duplicated variant name %q", v.Name)
+		}
+		names[v.Name] = true
+		for _, env := range v.Env {
+			if key, _, found := strings.Cut(env, "="); !found || key == "" {
+				return nil, fmt.Errorf("invalid env variable %q of variant %q, expected KEY=VALUE", env, v.Name)
+			}
+		}
+	}
+	return &matrix, nil
+}
@@ -0,0 +1,84 @@
+package envmatrix
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		want    *Matrix
+		wantErr bool
+	}{
+		{
+			name: "valid matrix",
+			data: `variants:
+  - name: single-proc
+    env:
+      - GOMAXPROCS=1
+  - name: cgo-resolver
+    env:
+      - GODEBUG=netdns=cgo
+  - name: default
+`,
+			want: &Matrix{
+				Variants: []Variant{
+					{Name: "single-proc", Env: []string{"GOMAXPROCS=1"}},
+					{Name: "cgo-resolver", Env: []string{"GODEBUG=netdns=cgo"}},
+					{Name: "default"},
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name:    "no variants",
+			data:    "variants: []\n",
+			want:    nil,
+			wantErr: true,
+		},
+		{
+			name:    "missing name",
+			data:    "variants:\n  - env: [GOMAXPROCS=1]\n",
+			want:    nil,
+			wantErr: true,
+		},
+		{
+			name:    "name with path separator",
+			data:    "variants:\n  - name: ../up\n",
+			want:    nil,
+			wantErr: true,
+		},
+		{
+			name:    "duplicated name",
+			data:    "variants:\n  - name: a\n  - name: a\n",
+			want:    nil,
+			wantErr: true,
+		},
+		{
+			name:    "invalid env variable",
+			data:    "variants:\n  - name: a\n    env: [GOMAXPROCS]\n",
+			want:    nil,
+			wantErr: true,
+		},
+		{
+			name:    "unknown field",
+			data:    "variants:\n  - name: a\n    environment: [GOMAXPROCS=1]\n",
+			want:    nil,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Parse([]byte(tt.data))
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Parse() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Parse() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,98 @@
+package executor
+
+import (
+	"fmt"
+	"os"
+	"os/user"
+	"strconv"
+	"syscall"
+)
+
+// LookupCredential returns the credential used to run the command
+// as the given user and group (names or numeric ids).
+// When they are not provided, the user that invoked sudo is used
+// (SUDO_UID/SUDO_GID), so that the command doesn't run as root.
+// Returns nil when there's no user to switch to.
+func LookupCredential(userName, groupName string) (*syscall.Credential, error) {
+	if userName == "" {
+		userName = os.Getenv("SUDO_UID")
+		if groupName == "" {
+			groupName = os.Getenv("SUDO_GID")
+		}
+	}
+	if userName == "" && groupName == "" {
+		return nil, nil
+	}
+
+	cred := &syscall.Credential{
+		Uid: uint32(os.Getuid()),
+		Gid: uint32(os.Getgid()),
+	}
+	if userName != "" {
+		u, err := lookupUser(userName)
+		if err != nil {
+			return nil, err
+		}
+		uid, err := strconv.ParseUint(u.Uid, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid uid %s for user %s: %v", u.Uid, userName, err)
+		}
+		cred.Uid = uint32(uid)
+		// unless specified, the group is the primary group of the user.
+		if groupName == "" {
+			groupName = u.Gid
+		}
+		// the supplementary groups are set as well, if available.
+		if u.Username != "" {
+			groupIDs, _ := u.GroupIds()
+			for _, id := range groupIDs {
+				gid, err := strconv.ParseUint(id, 10, 32)
+				if err != nil {
+					continue
+				}
+				cred.Groups = append(cred.Groups, uint32(gid))
+			}
+		}
+	}
+	if groupName != "" {
+		gid, err := lookupGroup(groupName)
+		if err != nil {
+			return nil, err
+		}
+		cred.Gid = gid
+	}
+	return cred, nil
+}
+
+// lookupUser looks up the user by name or id.
+// Numeric ids without a matching user (eg. within containers) are accepted too,
+// using the same id for the primary group.
+func lookupUser(name string) (*user.User, error) {
+	if _, err := strconv.ParseUint(name, 10, 32); err == nil {
+		if u, err := user.LookupId(name); err == nil {
+			return u, nil
+		}
+		return &user.User{Uid: name, Gid: name}, nil
+	}
+	u, err := user.Lookup(name)
+	if err != nil {
+		return nil, fmt.Errorf("error looking up user %s: %v", name, err)
+	}
+	return u, nil
+}
+
+// lookupGroup returns the id of the group, provided by name or id.
+func lookupGroup(name string) (uint32, error) {
+	if gid, err := strconv.ParseUint(name, 10, 32); err == nil {
+		return uint32(gid), nil
+	}
+	g, err := user.LookupGroup(name)
+	if err != nil {
+		return 0, fmt.Errorf("error looking up group %s: %v", name, err)
+	}
+	gid, err := strconv.ParseUint(g.Gid, 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid gid %s for group %s: %v", g.Gid, name, err)
+	}
+	return uint32(gid), nil
+}
@@ -0,0 +1,44 @@
+package executor
+
+import "testing"
+
+func TestLookupCredential(t *testing.T) {
+	t.Setenv("SUDO_UID", "")
+	t.Setenv("SUDO_GID", "")
+
+	cred, err := LookupCredential("", "")
+	if err != nil || cred != nil {
+		t.Errorf("LookupCredential() = %v, %v, want no credential", cred, err)
+	}
+
+	t.Setenv("SUDO_UID", "4242")
+	t.Setenv("SUDO_GID", "4343")
+	cred, err = LookupCredential("", "")
+	if err != nil {
+		t.Fatalf("LookupCredential() error = %v", err)
+	}
+	if cred.Uid != 4242 || cred.Gid != 4343 {
+		t.Errorf("LookupCredential() = %d:%d, want 4242:4343", cred.Uid, cred.Gid)
+	}
+
+	cred, err = LookupCredential("4244", "4545")
+	if err != nil {
+		t.Fatalf("LookupCredential() error = %v", err)
+	}
+	if cred.Uid != 4244 || cred.Gid != 4545 {
+		t.Errorf("LookupCredential() = %d:%d, want 4244:4545", cred.Uid, cred.Gid)
+	}
+
+	// the primary group of the user is used instead of SUDO_GID.
+	cred, err = LookupCredential("0", "")
+	if err != nil {
+		t.Fatalf("LookupCredential() error = %v", err)
+	}
+	if cred.Uid != 0 || cred.Gid != 0 {
+		t.Errorf("LookupCredential() = %d:%d, want 0:0", cred.Uid, cred.Gid)
+	}
+
+	if _, err := LookupCredential("harpoon-nonexistent-user", ""); err == nil {
+		t.Errorf("LookupCredential() expected error for unknown user")
+	}
+}
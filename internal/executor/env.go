@@ -0,0 +1,58 @@
+package executor
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// ReadEnvFile reads the environment variables from a file
+// with a KEY=VALUE entry per line (the same format used by docker).
+// Empty lines and lines starting with # are ignored,
+// as well as the optional "export " prefix and quotes around the value.
+func ReadEnvFile(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("error opening env file %s: %v", path, err)
+	}
+	defer file.Close()
+
+	var env []string
+	scanner := bufio.NewScanner(file)
+	line := 0
+	for scanner.Scan() {
+		line++
+		entry := strings.TrimSpace(scanner.Text())
+		if entry == "" || strings.HasPrefix(entry, "#") {
+			continue
+		}
+		entry = strings.TrimPrefix(entry, "export ")
+		key, value, found := strings.Cut(entry, "=")
+		key = strings.TrimSpace(key)
+		if !found || key == "" {
+			return nil, fmt.Errorf("invalid entry at %s:%d, expected KEY=VALUE", path, line)
+		}
+		value = strings.TrimSpace(value)
+		if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+			value = value[1 : len(value)-1]
+		}
+		env = append(env, key+"="+value)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading env file %s: %v", path, err)
+	}
+	return env, nil
+}
+
+// buildEnv returns the environment of the command:
+// ours, unless clean is set, followed by the custom variables.
+// The result is never nil, since a nil env makes exec
+// inherit our environment.
+func buildEnv(custom []string, clean bool) []string {
+	env := []string{}
+	if !clean {
+		env = os.Environ()
+	}
+	return append(env, custom...)
+}
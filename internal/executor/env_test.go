@@ -0,0 +1,81 @@
+package executor
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestReadEnvFile(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    []string
+		wantErr bool
+	}{
+		{
+			name:    "simple entries",
+			content: "VAR1=0\nVAR2=1\n",
+			want:    []string{"VAR1=0", "VAR2=1"},
+			wantErr: false,
+		},
+		{
+			name:    "comments and empty lines",
+			content: "# comment\n\nVAR1=0\n  # indented comment\n",
+			want:    []string{"VAR1=0"},
+			wantErr: false,
+		},
+		{
+			name:    "export prefix and quotes",
+			content: "export VAR1=\"a b\"\nVAR2='c=d'\nVAR3=\n",
+			want:    []string{"VAR1=a b", "VAR2=c=d", "VAR3="},
+			wantErr: false,
+		},
+		{
+			name:    "missing value separator",
+			content: "VAR1\n",
+			want:    nil,
+			wantErr: true,
+		},
+		{
+			name:    "missing key",
+			content: "=0\n",
+			want:    nil,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "env")
+			if err := os.WriteFile(path, []byte(tt.content), 0644); err != nil {
+				t.Fatal(err)
+			}
+			got, err := ReadEnvFile(path)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ReadEnvFile() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ReadEnvFile() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBuildEnv(t *testing.T) {
+	t.Setenv("HARPOON_TEST", "1")
+
+	got := buildEnv([]string{"VAR1=0"}, true)
+	if want := []string{"VAR1=0"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("buildEnv() = %v, want %v", got, want)
+	}
+	if got := buildEnv(nil, true); got == nil || len(got) != 0 {
+		t.Errorf("buildEnv() = %#v, want empty env", got)
+	}
+
+	got = buildEnv([]string{"VAR1=0"}, false)
+	if len(got) != len(os.Environ())+1 || got[len(got)-1] != "VAR1=0" {
+		t.Errorf("buildEnv() = %v, want our env followed by VAR1=0", got)
+	}
+}
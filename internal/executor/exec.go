@@ -2,36 +2,158 @@ package executor
 
 import (
 	"bufio"
+	"context"
+	"errors"
 	"fmt"
+	"io"
+	"io/fs"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
 	"sync"
+	"syscall"
+	"time"
 )
 
-// Run execute the command and wait for its end.
-// The cmdOutput argument is used to print the command output.
-func Run(cmd []string, envVars []string, cmdOutput, cmdError bool, wg *sync.WaitGroup, outputCh, errorCh chan<- string) {
-	defer func() {
-		wg.Done()
-	}()
+// killDelay is the time given to the command to terminate
+// once stopped, before getting killed.
+const killDelay = 5 * time.Second
+
+// RunOptions holds the options used to run the traced command.
+type RunOptions struct {
+	Env           []string
+	CommandOutput bool
+	CommandError  bool
+	// CgroupPath, when set, makes the command start
+	// within the given cgroup (v2).
+	CgroupPath string
+	// Stdin connects our stdin (even if it's a TTY) to the command.
+	Stdin bool
+	// StdoutFile and StderrFile, when set, receive the raw output
+	// of the command. "-" stands for our own stdout/stderr.
+	StdoutFile string
+	StderrFile string
+	// Credential, when set, is the user and group the command
+	// is executed as. Privileges are dropped before exec.
+	Credential *syscall.Credential
+	// Dir is the working directory of the command.
+	Dir string
+	// CleanEnv avoids passing our environment to the command,
+	// so that it only gets the Env variables.
+	CleanEnv bool
+	// Wrapper, when set, is the command executing the actual one,
+	// which is passed as its last arguments.
+	Wrapper []string
+	// Isolate starts the command in new mount, network, pid
+	// and ipc namespaces.
+	Isolate bool
+	// OnStart, when set, is called with the pid of the command
+	// right after it's started. On error, the command is killed.
+	OnStart func(pid int) error
+}
+
+// StartError is returned by Run when the command could not be started.
+type StartError struct {
+	Err error
+}
+
+func (e *StartError) Error() string {
+	return e.Err.Error()
+}
 
-	command := exec.Command(cmd[0], cmd[1:]...)
+func (e *StartError) Unwrap() error {
+	return e.Err
+}
+
+// Run execute the command and wait for its end.
+// The CommandOutput option is used to print the command output.
+// When the context is done, the command is terminated.
+// Returns the error of the command, if any (eg. *exec.ExitError),
+// or a *StartError when it could not be started.
+func Run(ctx context.Context, cmd []string, opts RunOptions, outputCh, errorCh chan<- string) error {
+	if len(opts.Wrapper) > 0 {
+		cmd = append(slices.Clone(opts.Wrapper), cmd...)
+	}
+	command := exec.CommandContext(ctx, cmd[0], cmd[1:]...)
+	// give the command the chance to terminate gracefully,
+	// before getting killed.
+	command.Cancel = func() error {
+		return command.Process.Signal(syscall.SIGTERM)
+	}
+	command.WaitDelay = killDelay
 	// assign custom env variables to the command
-	env := os.Environ()
-	if len(envVars) > 0 {
-		env = append(env, envVars...)
+	command.Env = buildEnv(opts.Env, opts.CleanEnv)
+	command.Dir = opts.Dir
+	if opts.Stdin {
+		command.Stdin = os.Stdin
+	}
+
+	stdoutFile, err := openOutput(opts.StdoutFile, os.Stdout)
+	if err != nil {
+		return &StartError{Err: err}
+	}
+	defer stdoutFile.Close()
+	stderrFile, err := openOutput(opts.StderrFile, os.Stderr)
+	if err != nil {
+		return &StartError{Err: err}
+	}
+	defer stderrFile.Close()
+
+	// when the output is not printed line by line,
+	// it is handed directly to the raw output file (if any).
+	var stdout, stderr io.Reader
+	if opts.CommandOutput {
+		stdout, _ = command.StdoutPipe()
+		if stdoutFile != nil {
+			stdout = io.TeeReader(stdout, stdoutFile)
+		}
+	} else if stdoutFile != nil {
+		command.Stdout = stdoutFile
+	}
+	if opts.CommandError {
+		stderr, _ = command.StderrPipe()
+		if stderrFile != nil {
+			stderr = io.TeeReader(stderr, stderrFile)
+		}
+	} else if stderrFile != nil {
+		command.Stderr = stderrFile
+	}
+
+	command.SysProcAttr = &syscall.SysProcAttr{
+		// setuid/setgid are done in the child, right before exec.
+		Credential: opts.Credential,
+	}
+	if opts.CgroupPath != "" {
+		cgroup, err := os.Open(opts.CgroupPath)
+		if err != nil {
+			return &StartError{Err: err}
+		}
+		defer cgroup.Close()
+		command.SysProcAttr.UseCgroupFD = true
+		command.SysProcAttr.CgroupFD = int(cgroup.Fd())
+	}
+	if opts.Isolate {
+		command.SysProcAttr.Cloneflags = syscall.CLONE_NEWPID | syscall.CLONE_NEWNET | syscall.CLONE_NEWIPC
+		// unsharing the mount namespace (instead of cloning it)
+		// makes the mounts private, so they don't leak to the host.
+		command.SysProcAttr.Unshareflags = syscall.CLONE_NEWNS
 	}
-	command.Env = env
-	stdout, _ := command.StdoutPipe()
-	stderr, _ := command.StderrPipe()
 
 	if err := command.Start(); err != nil {
-		fmt.Fprintf(os.Stderr, "command execution error: %v\n", err)
-		return
+		return &StartError{Err: err}
+	}
+	if opts.OnStart != nil {
+		if err := opts.OnStart(command.Process.Pid); err != nil {
+			command.Process.Kill()
+			command.Wait()
+			return &StartError{Err: err}
+		}
 	}
 
 	var ioWg sync.WaitGroup
-	if cmdOutput {
+	if opts.CommandOutput {
 		ioWg.Add(1)
 		go func() {
 			defer ioWg.Done()
@@ -44,7 +166,7 @@ func Run(cmd []string, envVars []string, cmdOutput, cmdError bool, wg *sync.Wait
 			}
 		}()
 	}
-	if cmdError {
+	if opts.CommandError {
 		ioWg.Add(1)
 		go func() {
 			defer ioWg.Done()
@@ -61,17 +183,138 @@ func Run(cmd []string, envVars []string, cmdOutput, cmdError bool, wg *sync.Wait
 	// wait for stdout/stderr scans to be completed
 	ioWg.Wait()
 	// wait for the executed command to be completed
-	command.Wait()
+	return command.Wait()
+}
+
+// openOutput opens the file receiving the raw output of the command.
+// The output is appended, since the command could be executed many times.
+// Returns nil when no file is provided.
+func openOutput(path string, std *os.File) (*os.File, error) {
+	switch path {
+	case "":
+		return nil, nil
+	case "-":
+		// duplicate the descriptor, so that closing it
+		// doesn't close our own stdout/stderr.
+		fd, err := syscall.Dup(int(std.Fd()))
+		if err != nil {
+			return nil, fmt.Errorf("error duplicating %s: %v", std.Name(), err)
+		}
+		return os.NewFile(uintptr(fd), std.Name()), nil
+	}
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("error opening file %s: %v", path, err)
+	}
+	return file, nil
+}
+
+// ExitCode converts the error returned by Run to the exit code
+// of the command, following the shell conventions.
+func ExitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		if status, ok := exitErr.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+			return 128 + int(status.Signal())
+		}
+		return exitErr.ExitCode()
+	}
+	// the command was not executed at all.
+	if errors.Is(err, fs.ErrPermission) {
+		return 126
+	}
+	return 127
+}
+
+// Wait waits for the end of a process that was not started by us.
+// When the context is done, it stops waiting leaving the process running.
+func Wait(ctx context.Context, pid int) {
+	ticker := time.NewTicker(500 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		if err := syscall.Kill(pid, 0); errors.Is(err, syscall.ESRCH) {
+			return
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// debugFlags are the flags the test binaries are always built with.
+var debugFlags = []string{
+	`-gcflags=all=-N -l`, // disable optimization
+}
+
+// BuildOptions holds the options of the go tool building the test binaries.
+type BuildOptions struct {
+	// GoBin is the go binary, "go" from the PATH when empty.
+	GoBin string
+	// Tags are the build tags (eg. integration, netgo).
+	Tags []string
+	// Flags are the additional build flags (eg. -ldflags=-s -w).
+	Flags []string
+	// Env are the additional KEY=VALUE variables
+	// of the go tool (eg. CGO_ENABLED=0).
+	Env []string
+}
+
+// BuildFlags returns the flags selecting the packages and the files
+// to be built, to be passed to go build and go list.
+func (o BuildOptions) BuildFlags() []string {
+	var flags []string
+	if len(o.Tags) > 0 {
+		flags = append(flags, "-tags="+strings.Join(o.Tags, ","))
+	}
+	return append(flags, o.Flags...)
+}
+
+// TestFlags returns all the flags the test binaries are built with.
+func (o BuildOptions) TestFlags() []string {
+	return append(slices.Clone(debugFlags), o.BuildFlags()...)
+}
+
+// GoCommand returns the go command with the given arguments,
+// to be run from dir with the environment of the options.
+func (o BuildOptions) GoCommand(dir string, args ...string) *exec.Cmd {
+	goBin := o.GoBin
+	if goBin == "" {
+		goBin = "go"
+	}
+	cmd := exec.Command(goBin, args...)
+	cmd.Dir = dir
+	cmd.Env = o.Environ()
+	return cmd
+}
+
+// Environ returns the environment of the go tool: ours with the additional
+// variables and, when GoBin is a path, its directory first in the PATH,
+// so that the tools running go find the same one.
+func (o BuildOptions) Environ() []string {
+	env := o.Env
+	if strings.ContainsRune(o.GoBin, filepath.Separator) {
+		if dir, err := filepath.Abs(filepath.Dir(o.GoBin)); err == nil {
+			path := dir + string(filepath.ListSeparator) + os.Getenv("PATH")
+			env = append([]string{"PATH=" + path}, env...)
+		}
+	}
+	return buildEnv(env, false)
 }
 
-func Build(packagePath, outputFile string) (string, error) {
-	cmd := exec.Command(
-		"go",
-		"test",
-		`-gcflags=all=-N -l`, // disable optimization
-		"-c", packagePath,    // build test binary
+// Build builds the test binary of the package,
+// running the go tool from the given directory (the module one).
+func Build(dir, packagePath, outputFile string, opts BuildOptions) (string, error) {
+	args := append([]string{"test"}, opts.TestFlags()...)
+	args = append(args,
+		"-c", packagePath, // build test binary
 		"-o", outputFile, // save it in a dedicated directory
 	)
+	cmd := opts.GoCommand(dir, args...)
 
 	stdout, err := cmd.CombinedOutput()
 	if err != nil {
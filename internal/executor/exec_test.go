@@ -0,0 +1,216 @@
+package executor
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+func TestRunExitCode(t *testing.T) {
+	tests := []struct {
+		name string
+		cmd  []string
+		want int
+	}{
+		{
+			name: "success",
+			cmd:  []string{"sh", "-c", "exit 0"},
+			want: 0,
+		},
+		{
+			name: "failure",
+			cmd:  []string{"sh", "-c", "exit 3"},
+			want: 3,
+		},
+		{
+			name: "killed by signal",
+			cmd:  []string{"sh", "-c", "kill -KILL $$"},
+			want: 137,
+		},
+		{
+			name: "command not found",
+			cmd:  []string{"/nonexistent/command"},
+			want: 127,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Run(context.Background(), tt.cmd, RunOptions{}, nil, nil)
+			if got := ExitCode(err); got != tt.want {
+				t.Errorf("ExitCode() = %v, want %v (error: %v)", got, tt.want, err)
+			}
+			var startErr *StartError
+			// only the command not found is not started.
+			if got, want := errors.As(err, &startErr), tt.want == 127; got != want {
+				t.Errorf("Run() error = %v, start error %v, want %v", err, got, want)
+			}
+		})
+	}
+}
+
+func TestRunOutputFile(t *testing.T) {
+	dir := t.TempDir()
+	stdout := filepath.Join(dir, "stdout")
+	stderr := filepath.Join(dir, "stderr")
+	opts := RunOptions{
+		StdoutFile: stdout,
+		StderrFile: stderr,
+	}
+	// the output is appended to the files, without being altered.
+	cmd := []string{"sh", "-c", "printf 'out\\n\\000'; printf err >&2"}
+	for i := 0; i < 2; i++ {
+		if err := Run(context.Background(), cmd, opts, nil, nil); err != nil {
+			t.Fatalf("Run() error = %v", err)
+		}
+	}
+
+	got, err := os.ReadFile(stdout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "out\n\x00out\n\x00"; string(got) != want {
+		t.Errorf("stdout = %q, want %q", got, want)
+	}
+	got, err = os.ReadFile(stderr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "errerr"; string(got) != want {
+		t.Errorf("stderr = %q, want %q", got, want)
+	}
+}
+
+func TestRunWorkdirAndCleanEnv(t *testing.T) {
+	t.Setenv("HARPOON_TEST", "1")
+	dir := t.TempDir()
+	stdout := filepath.Join(dir, "stdout")
+	opts := RunOptions{
+		Env:        []string{"VAR1=0"},
+		CleanEnv:   true,
+		Dir:        dir,
+		StdoutFile: stdout,
+	}
+	cmd := []string{"/bin/sh", "-c", "pwd; env"}
+	if err := Run(context.Background(), cmd, opts, nil, nil); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	got, err := os.ReadFile(stdout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the shell could export a few variables on its own (eg. PWD).
+	output := string(got)
+	if !strings.HasPrefix(output, dir+"\n") {
+		t.Errorf("stdout = %q, want working directory %q", output, dir)
+	}
+	if !strings.Contains(output, "VAR1=0") || strings.Contains(output, "HARPOON_TEST=") {
+		t.Errorf("stdout = %q, want VAR1 and not our environment", output)
+	}
+}
+
+func TestRunCredential(t *testing.T) {
+	if os.Getuid() != 0 {
+		t.Skip("changing user requires root privileges")
+	}
+	stdout := filepath.Join(t.TempDir(), "stdout")
+	opts := RunOptions{
+		Credential: &syscall.Credential{Uid: 65534, Gid: 65534},
+		StdoutFile: stdout,
+	}
+	cmd := []string{"/bin/sh", "-c", "id -u; id -g"}
+	if err := Run(context.Background(), cmd, opts, nil, nil); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	got, err := os.ReadFile(stdout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "65534\n65534\n"; string(got) != want {
+		t.Errorf("stdout = %q, want %q", got, want)
+	}
+}
+
+func TestRunIsolate(t *testing.T) {
+	if os.Getuid() != 0 {
+		t.Skip("creating namespaces requires root privileges")
+	}
+	stdout := filepath.Join(t.TempDir(), "stdout")
+	var startedPID int
+	opts := RunOptions{
+		Isolate:    true,
+		StdoutFile: stdout,
+		OnStart: func(pid int) error {
+			startedPID = pid
+			return nil
+		},
+	}
+	// within the new pid namespace, the command is the init process.
+	cmd := []string{"/bin/sh", "-c", "echo $$"}
+	if err := Run(context.Background(), cmd, opts, nil, nil); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	got, err := os.ReadFile(stdout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "1\n"; string(got) != want {
+		t.Errorf("stdout = %q, want %q", got, want)
+	}
+	// the pid passed to OnStart is the one seen from the host.
+	if startedPID <= 1 {
+		t.Errorf("OnStart() pid = %d, want host pid", startedPID)
+	}
+}
+
+func TestBuildOptions(t *testing.T) {
+	tests := []struct {
+		name      string
+		opts      BuildOptions
+		wantBuild []string
+		wantTest  []string
+	}{
+		{
+			name:     "default",
+			wantTest: []string{"-gcflags=all=-N -l"},
+		},
+		{
+			name: "tags and flags",
+			opts: BuildOptions{
+				Tags:  []string{"integration", "netgo"},
+				Flags: []string{"-ldflags=-s -w", "-trimpath"},
+			},
+			wantBuild: []string{"-tags=integration,netgo", "-ldflags=-s -w", "-trimpath"},
+			wantTest:  []string{"-gcflags=all=-N -l", "-tags=integration,netgo", "-ldflags=-s -w", "-trimpath"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.opts.BuildFlags(); !slices.Equal(got, tt.wantBuild) {
+				t.Errorf("BuildFlags() = %q, want %q", got, tt.wantBuild)
+			}
+			if got := tt.opts.TestFlags(); !slices.Equal(got, tt.wantTest) {
+				t.Errorf("TestFlags() = %q, want %q", got, tt.wantTest)
+			}
+		})
+	}
+
+	opts := BuildOptions{GoBin: "/opt/go/bin/go", Env: []string{"CGO_ENABLED=0"}}
+	cmd := opts.GoCommand("/src", "env", "GOVERSION")
+	if cmd.Path != "/opt/go/bin/go" || cmd.Dir != "/src" {
+		t.Errorf("GoCommand() = %s in %s, want /opt/go/bin/go in /src", cmd.Path, cmd.Dir)
+	}
+	if env := cmd.Env; env[len(env)-1] != "CGO_ENABLED=0" {
+		t.Errorf("GoCommand() env = %q, want CGO_ENABLED=0 last", env)
+	}
+	if !slices.ContainsFunc(cmd.Env, func(v string) bool { return strings.HasPrefix(v, "PATH=/opt/go/bin:") }) {
+		t.Errorf("GoCommand() env = %q, want /opt/go/bin first in PATH", cmd.Env)
+	}
+}
@@ -1,35 +1,351 @@
 package metadata
 
-import "fmt"
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Version is the version of the report format.
+// It's increased when the format changes in a way
+// the older versions of harpoon can't read.
+const Version = 1
+
+// ErrIncompatibleVersion is returned when reading a report
+// with a version other than the supported one.
+var ErrIncompatibleVersion = errors.New("incompatible report version")
+
+// Format is the encoding of the report.
+type Format string
+
+const (
+	FormatYAML Format = "yaml"
+	FormatJSON Format = "json"
+)
+
+var digestRegexp = regexp.MustCompile(`^sha256:[0-9a-f]{64}$`)
 
 type SymbolsList struct {
-	SymbolsOrigins []SymbolsOrigin `yaml:"symbolsOrigins"`
+	Version int `yaml:"version" json:"version"`
+	// BaseDir is the directory the analysis ran from,
+	// which the relative paths of the report are relative to.
+	BaseDir string `yaml:"baseDir,omitempty" json:"baseDir,omitempty"`
+	// Build holds how the test binaries were built,
+	// when not with the default go tool settings.
+	Build          *BuildInfo      `yaml:"build,omitempty" json:"build,omitempty"`
+	SymbolsOrigins []SymbolsOrigin `yaml:"symbolsOrigins,omitempty" json:"symbolsOrigins,omitempty"`
+	// Modules holds a section per module,
+	// when analyzing multiple modules (eg. a go.work workspace).
+	Modules []ModuleSymbols `yaml:"modules,omitempty" json:"modules,omitempty"`
+	// Untested holds the functions never run by the tests,
+	// when the analysis used a coverage profile.
+	Untested []string `yaml:"untested,omitempty" json:"untested,omitempty"`
+
+	// reportDir is the directory of the report file, once loaded.
+	reportDir string
+	// reportPath and reportFormat are the file the report was loaded from,
+	// and its format, where Save writes it back.
+	reportPath   string
+	reportFormat Format
+}
+
+// BuildInfo are the options the test binaries were built with.
+type BuildInfo struct {
+	Go    string   `yaml:"go,omitempty" json:"go,omitempty"`
+	Tags  []string `yaml:"tags,omitempty" json:"tags,omitempty"`
+	Flags []string `yaml:"flags,omitempty" json:"flags,omitempty"`
+	Env   []string `yaml:"env,omitempty" json:"env,omitempty"`
+}
+
+// IsEmpty returns true when the default options were used.
+func (bi *BuildInfo) IsEmpty() bool {
+	return bi.Go == "" && len(bi.Tags) == 0 && len(bi.Flags) == 0 && len(bi.Env) == 0
+}
+
+// ModuleSymbols are the symbols found within the tests of a module.
+type ModuleSymbols struct {
+	Path           string          `yaml:"path" json:"path"`
+	Dir            string          `yaml:"dir" json:"dir"`
+	SymbolsOrigins []SymbolsOrigin `yaml:"symbolsOrigins" json:"symbolsOrigins"`
+	Untested       []string        `yaml:"untested,omitempty" json:"untested,omitempty"`
 }
 
 func NewSymbolsList() *SymbolsList {
-	return &SymbolsList{}
+	return &SymbolsList{
+		Version: Version,
+	}
 }
 
 func (sl *SymbolsList) Add(so *SymbolsOrigin) {
 	sl.SymbolsOrigins = append(sl.SymbolsOrigins, *so)
 }
 
-func (sl *SymbolsList) String() string {
-	output := "---\n"
-	output += "symbolsOrigins:\n"
-	for _, symbolsOrigin := range sl.SymbolsOrigins {
-		output += fmt.Sprintf("  - testBinaryPath: %s\n", symbolsOrigin.TestBinaryPath)
-		output += "    symbols:\n"
-		for _, symbol := range symbolsOrigin.Symbols {
-			output += fmt.Sprintf("    - %s\n", symbol)
+// AddModule adds the section of a module.
+func (sl *SymbolsList) AddModule(ms ModuleSymbols) {
+	sl.Modules = append(sl.Modules, ms)
+}
+
+// Origins returns the symbols origins of the list and of all its modules.
+func (sl *SymbolsList) Origins() []SymbolsOrigin {
+	origins := append([]SymbolsOrigin{}, sl.SymbolsOrigins...)
+	for _, module := range sl.Modules {
+		origins = append(origins, module.SymbolsOrigins...)
+	}
+	return origins
+}
+
+// Encode writes the list in the given format.
+func (sl *SymbolsList) Encode(w io.Writer, format Format) error {
+	var data []byte
+	var err error
+	switch format {
+	case FormatYAML:
+		data, err = yaml.Marshal(sl)
+		data = append([]byte("---\n"), data...)
+	case FormatJSON:
+		data, err = json.MarshalIndent(sl, "", "  ")
+		data = append(data, '\n')
+	default:
+		return fmt.Errorf("unknown report format %q", format)
+	}
+	if err != nil {
+		return fmt.Errorf("error encoding report: %v", err)
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+// Load reads the report file, see Parse.
+func Load(path string) (*SymbolsList, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	sl, err := Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read report %s: %w", path, err)
+	}
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return nil, fmt.Errorf("error resolving path of %s: %v", path, err)
+	}
+	sl.reportDir = filepath.Dir(absPath)
+	sl.reportPath = path
+	sl.reportFormat = formatOf(data)
+	return sl, nil
+}
+
+// Save writes the report back into the file it was loaded from,
+// in the same format.
+func (sl *SymbolsList) Save() error {
+	if sl.reportPath == "" {
+		return fmt.Errorf("the report was not loaded from a file")
+	}
+	var buf bytes.Buffer
+	if err := sl.Encode(&buf, sl.reportFormat); err != nil {
+		return err
+	}
+	if err := os.WriteFile(sl.reportPath, buf.Bytes(), 0644); err != nil {
+		return fmt.Errorf("error writing into %s: %v", sl.reportPath, err)
+	}
+	return nil
+}
+
+// UpdateOrigin replaces the symbols origin of the same test binary
+// (eg. with the digests of the binary built again).
+// Returns false when the report has no such test binary.
+func (sl *SymbolsList) UpdateOrigin(so SymbolsOrigin) bool {
+	origins := [][]SymbolsOrigin{sl.SymbolsOrigins}
+	for _, module := range sl.Modules {
+		origins = append(origins, module.SymbolsOrigins)
+	}
+	for _, list := range origins {
+		for i := range list {
+			if list[i].TestBinaryPath == so.TestBinaryPath {
+				list[i] = so
+				return true
+			}
 		}
 	}
-	return output
+	return false
+}
+
+// Resolve returns the path of the report (eg. a testBinaryPath)
+// resolved against the base directory. When the base directory
+// doesn't exist (eg. the project was moved, along with the report)
+// the directory of the report file is used instead.
+func (sl *SymbolsList) Resolve(path string) string {
+	if path == "" || filepath.IsAbs(path) {
+		return path
+	}
+	if sl.BaseDir != "" {
+		if info, err := os.Stat(sl.BaseDir); err == nil && info.IsDir() {
+			return filepath.Join(sl.BaseDir, path)
+		}
+	}
+	if sl.reportDir != "" {
+		return filepath.Join(sl.reportDir, path)
+	}
+	return path
+}
+
+// Parse decodes the report, in YAML or JSON,
+// checking its version is the supported one.
+func Parse(data []byte) (*SymbolsList, error) {
+	if err := checkVersion(data); err != nil {
+		return nil, err
+	}
+	var sl SymbolsList
+	if err := decode(data, &sl, false); err != nil {
+		return nil, err
+	}
+	return &sl, nil
+}
+
+// Validate checks the report against the schema of its version:
+// every field must be known, and every symbols origin must have
+// a test binary with some symbols.
+func Validate(data []byte) error {
+	if err := checkVersion(data); err != nil {
+		return err
+	}
+	var sl SymbolsList
+	if err := decode(data, &sl, true); err != nil {
+		return err
+	}
+
+	var errs []error
+	if len(sl.SymbolsOrigins) > 0 && len(sl.Modules) > 0 {
+		errs = append(errs, fmt.Errorf("symbolsOrigins and modules can't be both set"))
+	}
+	errs = append(errs, validateOrigins("symbolsOrigins", sl.SymbolsOrigins)...)
+	for i, module := range sl.Modules {
+		field := fmt.Sprintf("modules[%d]", i)
+		if module.Path == "" {
+			errs = append(errs, fmt.Errorf("%s: missing path", field))
+		}
+		errs = append(errs, validateOrigins(field+".symbolsOrigins", module.SymbolsOrigins)...)
+	}
+	return errors.Join(errs...)
+}
+
+func validateOrigins(field string, origins []SymbolsOrigin) []error {
+	var errs []error
+	for i, so := range origins {
+		field := fmt.Sprintf("%s[%d]", field, i)
+		if so.TestBinaryPath == "" {
+			errs = append(errs, fmt.Errorf("%s: missing testBinaryPath", field))
+		}
+		if len(so.Symbols) == 0 {
+			errs = append(errs, fmt.Errorf("%s: missing symbols", field))
+		}
+		if so.Digest != "" && !digestRegexp.MatchString(so.Digest) {
+			errs = append(errs, fmt.Errorf("%s: invalid digest %q, expected sha256:<hex>", field, so.Digest))
+		}
+		if so.InputsDigest != "" && !digestRegexp.MatchString(so.InputsDigest) {
+			errs = append(errs, fmt.Errorf("%s: invalid inputsDigest %q, expected sha256:<hex>", field, so.InputsDigest))
+		}
+		for symbol := range so.Paths {
+			if !slices.Contains(so.Symbols, symbol) {
+				errs = append(errs, fmt.Errorf("%s: path of unknown symbol %q", field, symbol))
+			}
+		}
+		for symbol, tests := range so.SymbolTests {
+			if !slices.Contains(so.Symbols, symbol) {
+				errs = append(errs, fmt.Errorf("%s: tests of unknown symbol %q", field, symbol))
+			}
+			if len(tests) == 0 {
+				errs = append(errs, fmt.Errorf("%s: missing tests of symbol %q", field, symbol))
+			}
+		}
+	}
+	return errs
+}
+
+// checkVersion returns an error when the version
+// of the report is not the supported one.
+func checkVersion(data []byte) error {
+	var header struct {
+		Version int `yaml:"version" json:"version"`
+	}
+	if err := decode(data, &header, false); err != nil {
+		return err
+	}
+	switch {
+	case header.Version == Version:
+		return nil
+	case header.Version == 0:
+		return fmt.Errorf("%w: the report has no version, it was written by an older harpoon (run harpoon analyze again)", ErrIncompatibleVersion)
+	case header.Version > Version:
+		return fmt.Errorf("%w: the report has version %d, this harpoon reads version %d (update harpoon)", ErrIncompatibleVersion, header.Version, Version)
+	default:
+		return fmt.Errorf("%w: the report has version %d, this harpoon reads version %d (run harpoon analyze again)", ErrIncompatibleVersion, header.Version, Version)
+	}
+}
+
+// formatOf returns the format of the encoded report.
+func formatOf(data []byte) Format {
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '{' {
+		return FormatJSON
+	}
+	return FormatYAML
+}
+
+// decode unmarshals the report, as JSON when it's an object,
+// as YAML otherwise. With strict, the unknown fields are an error.
+func decode(data []byte, v any, strict bool) error {
+	if formatOf(data) == FormatJSON {
+		dec := json.NewDecoder(bytes.NewReader(data))
+		if strict {
+			dec.DisallowUnknownFields()
+		}
+		if err := dec.Decode(v); err != nil {
+			return fmt.Errorf("error decoding JSON report: %v", err)
+		}
+		return nil
+	}
+	unmarshal := yaml.Unmarshal
+	if strict {
+		unmarshal = yaml.UnmarshalStrict
+	}
+	if err := unmarshal(data, v); err != nil {
+		return fmt.Errorf("error decoding YAML report: %v", err)
+	}
+	return nil
 }
 
 type SymbolsOrigin struct {
-	TestBinaryPath string   `yaml:"testBinaryPath"`
-	Symbols        []string `yaml:"symbols"`
+	TestBinaryPath string `yaml:"testBinaryPath" json:"testBinaryPath"`
+	// Package is the import path of the package the binary tests.
+	Package string `yaml:"package,omitempty" json:"package,omitempty"`
+	// Dir is the directory of the package.
+	Dir string `yaml:"dir,omitempty" json:"dir,omitempty"`
+	// Digest is the SHA-256 digest of the test binary (sha256:<hex>).
+	Digest string `yaml:"digest,omitempty" json:"digest,omitempty"`
+	// BuildID is the Go build ID of the test binary.
+	BuildID string `yaml:"buildID,omitempty" json:"buildID,omitempty"`
+	// InputsDigest is the digest of the files the test binary
+	// is built from, its build flags and toolchain (sha256:<hex>).
+	InputsDigest string `yaml:"inputsDigest,omitempty" json:"inputsDigest,omitempty"`
+	// Tests are the names of the test functions of the package.
+	Tests   []string `yaml:"tests,omitempty" json:"tests,omitempty"`
+	Symbols []string `yaml:"symbols" json:"symbols"`
+	// SymbolTests holds, for each symbol, the tests referencing
+	// its function, so that only those are run while tracing it.
+	SymbolTests map[string][]string `yaml:"symbolTests,omitempty" json:"symbolTests,omitempty"`
+	// Paths holds, for each symbol, the chain of calls
+	// from a test to its function (when analyzing the call graph).
+	Paths map[string][]string `yaml:"paths,omitempty" json:"paths,omitempty"`
 }
 
 func NewSymbolsOrigin(testBinPath string) *SymbolsOrigin {
@@ -45,3 +361,51 @@ func (so *SymbolsOrigin) IsEmpty() bool {
 func (so *SymbolsOrigin) Add(symbol string) {
 	so.Symbols = append(so.Symbols, symbol)
 }
+
+// AddTests sets the tests referencing the symbol function.
+func (so *SymbolsOrigin) AddTests(symbol string, tests []string) {
+	if len(tests) == 0 {
+		return
+	}
+	if so.SymbolTests == nil {
+		so.SymbolTests = make(map[string][]string)
+	}
+	so.SymbolTests[symbol] = tests
+}
+
+// AddPath sets the chain of calls from a test to the symbol function.
+func (so *SymbolsOrigin) AddPath(symbol string, path []string) {
+	if so.Paths == nil {
+		so.Paths = make(map[string][]string)
+	}
+	so.Paths[symbol] = path
+}
+
+// Limit keeps the first max symbols, along with their tests and paths,
+// and returns the number of symbols removed.
+func (so *SymbolsOrigin) Limit(max int) int {
+	if max <= 0 || len(so.Symbols) <= max {
+		return 0
+	}
+	removed := so.Symbols[max:]
+	for _, symbol := range removed {
+		delete(so.SymbolTests, symbol)
+		delete(so.Paths, symbol)
+	}
+	so.Symbols = so.Symbols[:max]
+	return len(removed)
+}
+
+// FileDigest returns the SHA-256 digest of the file, as sha256:<hex>.
+func FileDigest(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("error computing digest: %w", err)
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", fmt.Errorf("error computing digest of %s: %v", path, err)
+	}
+	return "sha256:" + hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,299 @@
+package metadata
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func testList() *SymbolsList {
+	sl := NewSymbolsList()
+	sl.Build = &BuildInfo{Tags: []string{"integration"}, Flags: []string{"-ldflags=-s -w"}}
+	so := NewSymbolsOrigin(".harpoon/__pkg_store.test")
+	so.Package = "example.com/app/pkg/store"
+	so.Digest = "sha256:" + strings.Repeat("ab", 32)
+	so.Tests = []string{"TestGet", "TestSet"}
+	// generics and quotes used to break the report.
+	so.Add("example.com/app/pkg/store.(*Store[...]).Get")
+	so.Add(`example.com/app/pkg/store.Set: "x"`)
+	so.AddTests("example.com/app/pkg/store.(*Store[...]).Get", []string{"TestGet"})
+	so.AddTests(`example.com/app/pkg/store.Set: "x"`, nil)
+	so.AddPath("example.com/app/pkg/store.(*Store[...]).Get", []string{"example.com/app/pkg/store.TestGet", "example.com/app/pkg/store.(*Store[...]).Get"})
+	sl.Add(so)
+	sl.Untested = []string{"example.com/app/pkg/store.Store.Delete"}
+	return sl
+}
+
+func TestEncodeParse(t *testing.T) {
+	for _, format := range []Format{FormatYAML, FormatJSON} {
+		t.Run(string(format), func(t *testing.T) {
+			want := testList()
+			var buf bytes.Buffer
+			if err := want.Encode(&buf, format); err != nil {
+				t.Fatalf("Encode() error = %v", err)
+			}
+			got, err := Parse(buf.Bytes())
+			if err != nil {
+				t.Fatalf("Parse() error = %v\n%s", err, buf.String())
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("Parse() = %+v, want %+v", got, want)
+			}
+			if err := Validate(buf.Bytes()); err != nil {
+				t.Errorf("Validate() error = %v", err)
+			}
+		})
+	}
+
+	var buf bytes.Buffer
+	if err := testList().Encode(&buf, "toml"); err == nil {
+		t.Errorf("Encode() expected error for unknown format")
+	}
+}
+
+func TestVersion(t *testing.T) {
+	tests := []struct {
+		name    string
+		report  string
+		wantErr string
+	}{
+		{
+			name:   "current",
+			report: "version: 1\nsymbolsOrigins: []\n",
+		},
+		{
+			name:    "unversioned",
+			report:  "---\nsymbolsOrigins:\n  - testBinaryPath: a.test\n    symbols:\n    - main.A\n",
+			wantErr: "no version",
+		},
+		{
+			name:    "newer",
+			report:  `{"version": 2}`,
+			wantErr: "update harpoon",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse([]byte(tt.report))
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("Parse() error = %v", err)
+				}
+				return
+			}
+			if !errors.Is(err, ErrIncompatibleVersion) || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Parse() error = %v, want %v containing %q", err, ErrIncompatibleVersion, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		report  string
+		wantErr []string
+	}{
+		{
+			name:   "modules",
+			report: "version: 1\nmodules:\n- path: example.com/api\n  dir: api\n  symbolsOrigins:\n  - testBinaryPath: a.test\n    symbols:\n    - example.com/api.A\n",
+		},
+		{
+			name:    "unknown field",
+			report:  "version: 1\nsymbolOrigins: []\n",
+			wantErr: []string{"symbolOrigins"},
+		},
+		{
+			name:    "unknown JSON field",
+			report:  `{"version": 1, "symbols": []}`,
+			wantErr: []string{"symbols"},
+		},
+		{
+			name:    "missing fields",
+			report:  "version: 1\nsymbolsOrigins:\n- digest: md5:abc\n  symbols: []\n  paths:\n    main.A: [main.TestA, main.A]\n",
+			wantErr: []string{"missing testBinaryPath", "missing symbols", "invalid digest", `path of unknown symbol "main.A"`},
+		},
+		{
+			name:    "symbol tests",
+			report:  "version: 1\nsymbolsOrigins:\n- testBinaryPath: a.test\n  symbols: [main.A]\n  symbolTests:\n    main.A: []\n    main.B: [TestB]\n",
+			wantErr: []string{`missing tests of symbol "main.A"`, `tests of unknown symbol "main.B"`},
+		},
+		{
+			name:    "missing module path",
+			report:  "version: 1\nmodules:\n- dir: api\n  symbolsOrigins: []\n",
+			wantErr: []string{"modules[0]: missing path"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Validate([]byte(tt.report))
+			if len(tt.wantErr) == 0 {
+				if err != nil {
+					t.Errorf("Validate() error = %v", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("Validate() expected error")
+			}
+			for _, want := range tt.wantErr {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("Validate() error = %v, want it to contain %q", err, want)
+				}
+			}
+		})
+	}
+}
+
+func TestLimit(t *testing.T) {
+	so := NewSymbolsOrigin("a.test")
+	for _, symbol := range []string{"main.A", "main.B", "main.C"} {
+		so.Add(symbol)
+		so.AddTests(symbol, []string{"Test" + symbol[len("main."):]})
+		so.AddPath(symbol, []string{"main.TestA", symbol})
+	}
+	if got := so.Limit(0); got != 0 || len(so.Symbols) != 3 {
+		t.Errorf("Limit(0) = %d, symbols %v, want no limit", got, so.Symbols)
+	}
+	if got := so.Limit(2); got != 1 {
+		t.Errorf("Limit(2) = %d, want 1", got)
+	}
+	if want := []string{"main.A", "main.B"}; !reflect.DeepEqual(so.Symbols, want) {
+		t.Errorf("Limit() symbols = %v, want %v", so.Symbols, want)
+	}
+	if _, ok := so.SymbolTests["main.C"]; ok {
+		t.Errorf("Limit() kept the tests of main.C")
+	}
+	if _, ok := so.Paths["main.C"]; ok {
+		t.Errorf("Limit() kept the path of main.C")
+	}
+}
+
+func TestFileDigest(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "a.test")
+	if err := os.WriteFile(path, []byte("binary"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	got, err := FileDigest(path)
+	if err != nil {
+		t.Fatalf("FileDigest() error = %v", err)
+	}
+	// sha256sum of "binary".
+	want := "sha256:9a3a45d01531a20e89ac6ae10b0b0beb0492acd7216a368aa062d1a5fecaf9cd"
+	if got != want {
+		t.Errorf("FileDigest() = %s, want %s", got, want)
+	}
+}
+
+func TestLoadResolve(t *testing.T) {
+	project := t.TempDir()
+	sl := NewSymbolsList()
+	sl.BaseDir = project
+	var buf bytes.Buffer
+	if err := sl.Encode(&buf, FormatYAML); err != nil {
+		t.Fatal(err)
+	}
+	reportPath := filepath.Join(project, "harpoon-report.yml")
+	if err := os.WriteFile(reportPath, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := Load(reportPath)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	tests := []struct {
+		path string
+		want string
+	}{
+		{".harpoon/__pkg.test", filepath.Join(project, ".harpoon/__pkg.test")},
+		{"/tmp/results/__pkg.test", "/tmp/results/__pkg.test"},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := report.Resolve(tt.path); got != tt.want {
+			t.Errorf("Resolve(%q) = %q, want %q", tt.path, got, tt.want)
+		}
+	}
+
+	// the project is moved along with the report.
+	moved := filepath.Join(t.TempDir(), "moved")
+	if err := os.Rename(project, moved); err != nil {
+		t.Fatal(err)
+	}
+	report, err = Load(filepath.Join(moved, "harpoon-report.yml"))
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if got, want := report.Resolve(".harpoon/__pkg.test"), filepath.Join(moved, ".harpoon/__pkg.test"); got != want {
+		t.Errorf("Resolve() = %q, want %q", got, want)
+	}
+
+	if _, err := Load(filepath.Join(moved, "missing.yml")); err == nil {
+		t.Errorf("Load() expected error for a missing report")
+	}
+}
+
+func TestUpdateSave(t *testing.T) {
+	for _, format := range []Format{FormatYAML, FormatJSON} {
+		t.Run(string(format), func(t *testing.T) {
+			sl := testList()
+			sl.AddModule(ModuleSymbols{
+				Path:           "example.com/api",
+				Dir:            "api",
+				SymbolsOrigins: []SymbolsOrigin{*NewSymbolsOrigin("api/.harpoon/__api.test")},
+			})
+			var buf bytes.Buffer
+			if err := sl.Encode(&buf, format); err != nil {
+				t.Fatal(err)
+			}
+			path := filepath.Join(t.TempDir(), "report")
+			if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			report, err := Load(path)
+			if err != nil {
+				t.Fatalf("Load() error = %v", err)
+			}
+			digest := "sha256:" + strings.Repeat("cd", 32)
+			for _, so := range report.Origins() {
+				so.Digest = digest
+				if !report.UpdateOrigin(so) {
+					t.Errorf("UpdateOrigin(%s) = false, want true", so.TestBinaryPath)
+				}
+			}
+			if report.UpdateOrigin(*NewSymbolsOrigin("missing.test")) {
+				t.Errorf("UpdateOrigin() = true for a missing test binary")
+			}
+			if err := report.Save(); err != nil {
+				t.Fatalf("Save() error = %v", err)
+			}
+
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := formatOf(data); got != format {
+				t.Errorf("Save() format = %s, want %s", got, format)
+			}
+			saved, err := Parse(data)
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+			for _, so := range saved.Origins() {
+				if so.Digest != digest {
+					t.Errorf("Save() digest of %s = %s, want %s", so.TestBinaryPath, so.Digest, digest)
+				}
+			}
+		})
+	}
+
+	if err := NewSymbolsList().Save(); err == nil {
+		t.Errorf("Save() expected error for a report not loaded")
+	}
+}
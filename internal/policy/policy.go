@@ -0,0 +1,252 @@
+package policy
+
+import (
+	"fmt"
+	"go/parser"
+	"go/token"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/alegrey91/harpoon/internal/elfreader"
+	"gopkg.in/yaml.v2"
+)
+
+// generatedRegexp matches the comment of the generated files,
+// see https://go.dev/s/generatedcode.
+var generatedRegexp = regexp.MustCompile(`^// Code generated .* DO NOT EDIT\.$`)
+
+// Policy selects the function symbols to be traced, eg:
+//
+//	include:
+//	  packages:
+//	    - /internal/(auth|crypto)$
+//	exclude:
+//	  receivers:
+//	    - ^mock
+//	  functions:
+//	    - ^String$
+//	  generated:
+//	    - protoc-gen-go
+//	maxSymbols: 50
+type Policy struct {
+	Include Rules `yaml:"include"`
+	Exclude Rules `yaml:"exclude"`
+	// MaxSymbols is the max number of symbols traced
+	// within each test binary, 0 means no limit.
+	MaxSymbols int `yaml:"maxSymbols"`
+}
+
+// Rules are the regular expressions matching the parts of the symbols.
+// A symbol matches when any expression of any list matches it.
+// The closures match as their enclosing function.
+type Rules struct {
+	// Packages match the import path of the package.
+	Packages []string `yaml:"packages"`
+	// Receivers match the name of the receiver type of the methods.
+	Receivers []string `yaml:"receivers"`
+	// Functions match the name of the function (or method).
+	Functions []string `yaml:"functions"`
+	// Generated match the "Code generated ... DO NOT EDIT." comment
+	// of the generated file declaring the function.
+	Generated []string `yaml:"generated"`
+
+	packages  []*regexp.Regexp
+	receivers []*regexp.Regexp
+	functions []*regexp.Regexp
+	generated []*regexp.Regexp
+}
+
+// closureRegexp matches the elements the compiler appends
+// to the name of the enclosing function of the closures.
+var closureRegexp = regexp.MustCompile(`^(func|gowrap|deferwrap)\d+$`)
+
+// Symbol is a function symbol split in its parts, eg.
+// example.com/app/pkg.(*Store[...]).Get is the Get function
+// of the Store receiver in the example.com/app/pkg package.
+type Symbol struct {
+	Package  string
+	Receiver string
+	Function string
+	// Closure is set for the closures (eg. func1, or func1.2 when nested),
+	// whose Receiver and Function are the ones of the enclosing function.
+	Closure string
+}
+
+// ParseSymbol splits the symbol in its parts.
+func ParseSymbol(symbol string) Symbol {
+	var s Symbol
+	// the type arguments could contain import paths.
+	symbol = elfreader.ElideTypeArgs(symbol)
+	// the import path ends with the last element, followed by the first dot
+	// after it: the linker escapes the dots of the last element (eg. yaml%2ev2).
+	slash := strings.LastIndex(symbol, "/")
+	dot := strings.Index(symbol[slash+1:], ".")
+	if dot < 0 {
+		return Symbol{Function: symbol}
+	}
+	s.Package = strings.ReplaceAll(symbol[:slash+1+dot], "%2e", ".")
+	name := strings.ReplaceAll(symbol[slash+1+dot+1:], "[...]", "")
+	// the pointer receivers are enclosed in parentheses, eg. (*Store).Get
+	if receiver, rest, found := strings.Cut(name, ")."); found && strings.HasPrefix(receiver, "(*") {
+		s.Receiver, name = strings.TrimPrefix(receiver, "(*"), rest
+	}
+	elems := strings.Split(name, ".")
+	for i, elem := range elems {
+		if closureRegexp.MatchString(elem) {
+			s.Closure = strings.Join(elems[i:], ".")
+			elems = elems[:i]
+			break
+		}
+	}
+	// the closures of the package variables, eg. glob..func1
+	if len(elems) > 1 && elems[len(elems)-1] == "" {
+		elems = elems[:len(elems)-1]
+	}
+	switch {
+	case s.Receiver == "" && len(elems) > 1:
+		s.Receiver, s.Function = elems[0], strings.Join(elems[1:], ".")
+	default:
+		s.Function = strings.Join(elems, ".")
+	}
+	return s
+}
+
+// Load reads the policy from the given file.
+func Load(path string) (*Policy, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading policy %s: %v", path, err)
+	}
+	policy, err := Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing policy %s: %v", path, err)
+	}
+	return policy, nil
+}
+
+// Parse parses the policy and compiles its expressions.
+func Parse(data []byte) (*Policy, error) {
+	var policy Policy
+	if err := yaml.UnmarshalStrict(data, &policy); err != nil {
+		return nil, err
+	}
+	if policy.MaxSymbols < 0 {
+		return nil, fmt.Errorf("invalid maxSymbols %d", policy.MaxSymbols)
+	}
+	if err := policy.Include.compile("include"); err != nil {
+		return nil, err
+	}
+	if err := policy.Exclude.compile("exclude"); err != nil {
+		return nil, err
+	}
+	return &policy, nil
+}
+
+// compile compiles the expressions of the rules.
+func (r *Rules) compile(name string) error {
+	var err error
+	if r.packages, err = compileAll(name+".packages", r.Packages); err != nil {
+		return err
+	}
+	if r.receivers, err = compileAll(name+".receivers", r.Receivers); err != nil {
+		return err
+	}
+	if r.functions, err = compileAll(name+".functions", r.Functions); err != nil {
+		return err
+	}
+	r.generated, err = compileAll(name+".generated", r.Generated)
+	return err
+}
+
+func compileAll(field string, exprs []string) ([]*regexp.Regexp, error) {
+	var res []*regexp.Regexp
+	for _, expr := range exprs {
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid expression of %s: %v", field, err)
+		}
+		res = append(res, re)
+	}
+	return res, nil
+}
+
+// isEmpty returns true when the rules have no expressions.
+func (r *Rules) isEmpty() bool {
+	return len(r.packages) == 0 && len(r.receivers) == 0 && len(r.functions) == 0 && len(r.generated) == 0
+}
+
+// match returns true when any expression matches the symbol.
+// The generated expressions match the marker of its file, if generated.
+func (r *Rules) match(s Symbol, marker string) bool {
+	return matchAny(r.packages, s.Package) ||
+		s.Receiver != "" && matchAny(r.receivers, s.Receiver) ||
+		matchAny(r.functions, s.Function) ||
+		marker != "" && matchAny(r.generated, marker)
+}
+
+func matchAny(res []*regexp.Regexp, s string) bool {
+	for _, re := range res {
+		if re.MatchString(s) {
+			return true
+		}
+	}
+	return false
+}
+
+// UsesFiles returns true when the policy needs
+// the source files of the symbols (see Select).
+func (p *Policy) UsesFiles() bool {
+	return len(p.Include.generated) > 0 || len(p.Exclude.generated) > 0
+}
+
+// Select returns the symbols matching the include rules, if any,
+// and none of the exclude rules, in the same order.
+// The files map the symbols to their source file, to find
+// the generated ones: the symbols without a file are not generated.
+func (p *Policy) Select(symbols []string, files map[string]string) []string {
+	if p.Include.isEmpty() && p.Exclude.isEmpty() {
+		return symbols
+	}
+	markers := make(map[string]string)
+	var selected []string
+	for _, symbol := range symbols {
+		var marker string
+		if file, ok := files[symbol]; ok {
+			if _, ok := markers[file]; !ok {
+				markers[file] = generatedMarker(file)
+			}
+			marker = markers[file]
+		}
+		s := ParseSymbol(symbol)
+		if !p.Include.isEmpty() && !p.Include.match(s, marker) {
+			continue
+		}
+		if p.Exclude.match(s, marker) {
+			continue
+		}
+		selected = append(selected, symbol)
+	}
+	return selected
+}
+
+// generatedMarker returns the comment marking the file as generated,
+// or an empty string for the files not generated (or not readable).
+func generatedMarker(path string) string {
+	node, err := parser.ParseFile(token.NewFileSet(), path, nil, parser.PackageClauseOnly|parser.ParseComments)
+	if err != nil {
+		return ""
+	}
+	// the comment is before the package clause.
+	for _, group := range node.Comments {
+		if group.Pos() > node.Package {
+			break
+		}
+		for _, comment := range group.List {
+			if generatedRegexp.MatchString(comment.Text) {
+				return comment.Text
+			}
+		}
+	}
+	return ""
+}
@@ -0,0 +1,154 @@
+package policy
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestParseSymbol(t *testing.T) {
+	tests := []struct {
+		symbol string
+		want   Symbol
+	}{
+		{"main.run", Symbol{Package: "main", Function: "run"}},
+		{"example.com/app/pkg.Get", Symbol{Package: "example.com/app/pkg", Function: "Get"}},
+		{"example.com/app/pkg.(*Store).Get", Symbol{Package: "example.com/app/pkg", Receiver: "Store", Function: "Get"}},
+		{"example.com/app/pkg.Store.Get", Symbol{Package: "example.com/app/pkg", Receiver: "Store", Function: "Get"}},
+		{"example.com/app/pkg.(*Store[...]).Get", Symbol{Package: "example.com/app/pkg", Receiver: "Store", Function: "Get"}},
+		{"example.com/app/pkg.Map[...]", Symbol{Package: "example.com/app/pkg", Function: "Map"}},
+		{"example.com/app/pkg.(*Store[go.shape.string]).Get", Symbol{Package: "example.com/app/pkg", Receiver: "Store", Function: "Get"}},
+		{"example.com/app/pkg.Map[go.shape.struct { F example.com/other.T }]", Symbol{Package: "example.com/app/pkg", Function: "Map"}},
+		{"gopkg.in/yaml%2ev2.Marshal", Symbol{Package: "gopkg.in/yaml.v2", Function: "Marshal"}},
+		{"example.com/app/pkg.Get.func1", Symbol{Package: "example.com/app/pkg", Function: "Get", Closure: "func1"}},
+		{"example.com/app/pkg.Get.func1.2", Symbol{Package: "example.com/app/pkg", Function: "Get", Closure: "func1.2"}},
+		{"example.com/app/pkg.Get.gowrap3", Symbol{Package: "example.com/app/pkg", Function: "Get", Closure: "gowrap3"}},
+		{"example.com/app/pkg.Store.Get.func1", Symbol{Package: "example.com/app/pkg", Receiver: "Store", Function: "Get", Closure: "func1"}},
+		{"example.com/app/pkg.(*Store[...]).Get.func1", Symbol{Package: "example.com/app/pkg", Receiver: "Store", Function: "Get", Closure: "func1"}},
+		{"example.com/app/pkg.glob..func1", Symbol{Package: "example.com/app/pkg", Function: "glob", Closure: "func1"}},
+	}
+	for _, tt := range tests {
+		if got := ParseSymbol(tt.symbol); got != tt.want {
+			t.Errorf("ParseSymbol(%q) = %+v, want %+v", tt.symbol, got, tt.want)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		wantErr bool
+	}{
+		{
+			name: "valid policy",
+			data: "include:\n  packages: [/internal/auth$]\nexclude:\n  functions: [^String$]\nmaxSymbols: 10\n",
+		},
+		{
+			name: "empty policy",
+			data: "",
+		},
+		{
+			name:    "invalid expression",
+			data:    "exclude:\n  receivers: ['(']\n",
+			wantErr: true,
+		},
+		{
+			name:    "negative max symbols",
+			data:    "maxSymbols: -1\n",
+			wantErr: true,
+		},
+		{
+			name:    "unknown field",
+			data:    "include:\n  package: [auth]\n",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse([]byte(tt.data))
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Parse() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSelect(t *testing.T) {
+	dir := t.TempDir()
+	generated := filepath.Join(dir, "store.pb.go")
+	if err := os.WriteFile(generated, []byte("// Code generated by protoc-gen-go. DO NOT EDIT.\n\npackage store\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	written := filepath.Join(dir, "store.go")
+	if err := os.WriteFile(written, []byte("package store\n\n// Code generated by hand. DO NOT EDIT.\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	symbols := []string{
+		"example.com/app/internal/auth.Login",
+		"example.com/app/internal/auth.(*mockUser).Login",
+		"example.com/app/internal/auth.Role.String",
+		"example.com/app/internal/store.(*Record).Reset",
+		"example.com/app/internal/store.Open",
+		"example.com/app/cmd.run",
+	}
+	files := map[string]string{
+		"example.com/app/internal/store.(*Record).Reset": generated,
+		"example.com/app/internal/store.Open":            written,
+	}
+	tests := []struct {
+		name      string
+		data      string
+		usesFiles bool
+		want      []string
+	}{
+		{
+			name: "no rules",
+			data: "maxSymbols: 1\n",
+			want: symbols,
+		},
+		{
+			name: "include packages",
+			data: "include:\n  packages: [/internal/]\n",
+			want: symbols[:5],
+		},
+		{
+			name: "exclude receivers and functions",
+			data: "exclude:\n  receivers: [^mock]\n  functions: [^String$]\n",
+			want: []string{symbols[0], symbols[3], symbols[4], symbols[5]},
+		},
+		{
+			name:      "exclude generated",
+			data:      "exclude:\n  generated: [protoc-gen-go]\n",
+			usesFiles: true,
+			want:      []string{symbols[0], symbols[1], symbols[2], symbols[4], symbols[5]},
+		},
+		{
+			name:      "include generated or functions",
+			data:      "include:\n  functions: [^run$]\n  generated: ['']\n",
+			usesFiles: true,
+			want:      []string{symbols[3], symbols[5]},
+		},
+		{
+			name: "include and exclude",
+			data: "include:\n  packages: [/auth$]\nexclude:\n  receivers: ['']\n",
+			want: symbols[:1],
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			policy, err := Parse([]byte(tt.data))
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+			if got := policy.UsesFiles(); got != tt.usesFiles {
+				t.Errorf("UsesFiles() = %v, want %v", got, tt.usesFiles)
+			}
+			if got := policy.Select(symbols, files); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Select() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,218 @@
+package recorder
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"sync"
+)
+
+// Version is the version of the recording format.
+// It must be increased every time the format changes
+// in a way that older readers can't handle.
+// Version 2 added the variant and the run of the events,
+// version 3 the run start records.
+const Version = 3
+
+// Format identifies a harpoon recording file.
+const Format = "harpoon-events"
+
+// Header is the first line of every recording file.
+type Header struct {
+	Format  string `json:"format"`
+	Version int    `json:"version"`
+}
+
+// KindIOUring marks the events of io_uring operations.
+// For these events, SyscallID holds the opcode of the operation.
+const KindIOUring = "io_uring"
+
+// KindRunStart marks the start of a run of the command tracing the symbol,
+// before any of its events, so that the runs (and the symbols)
+// without events are known as well. These records have no system call.
+const KindRunStart = "run_start"
+
+// Event is a single raw event collected from the ebpf program.
+type Event struct {
+	// Kind is empty for system calls.
+	Kind      string   `json:"kind,omitempty"`
+	Symbol    string   `json:"symbol"`
+	PID       uint32   `json:"pid"`
+	TID       uint32   `json:"tid"`
+	Timestamp uint64   `json:"timestamp"`
+	SyscallID uint32   `json:"syscallId"`
+	Args      []uint64 `json:"args,omitempty"`
+	// Test is the test (or subtest) running the event,
+	// when attributing the syscalls to the tests.
+	Test string `json:"test,omitempty"`
+	// Variant is the name of the env matrix variant
+	// the command was executed with, if any.
+	Variant string `json:"variant,omitempty"`
+	// Run is the number of the execution of the command, from 1 (see --runs).
+	Run int `json:"run,omitempty"`
+	// PerTest is set in the run start records
+	// when the syscalls are attributed to the tests.
+	PerTest bool `json:"perTest,omitempty"`
+}
+
+// Recorder writes events to a JSONL stream.
+// It is safe for concurrent use.
+type Recorder struct {
+	mu     sync.Mutex
+	w      *bufio.Writer
+	enc    *json.Encoder
+	closer io.Closer
+}
+
+// NewRecorder returns a Recorder writing to w.
+// The header is written immediately.
+func NewRecorder(w io.Writer) (*Recorder, error) {
+	bw := bufio.NewWriter(w)
+	r := &Recorder{
+		w:   bw,
+		enc: json.NewEncoder(bw),
+	}
+	if err := r.enc.Encode(Header{Format: Format, Version: Version}); err != nil {
+		return nil, fmt.Errorf("error writing header: %v", err)
+	}
+	return r, nil
+}
+
+// Create creates the file at path and returns a Recorder writing into it.
+func Create(path string) (*Recorder, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("error creating file %s: %v", path, err)
+	}
+	r, err := NewRecorder(file)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	r.closer = file
+	return r, nil
+}
+
+// Record appends the event to the stream.
+func (r *Recorder) Record(e Event) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.enc.Encode(e)
+}
+
+// Close flushes the buffered events and closes the underlying file, if any.
+func (r *Recorder) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	err := r.w.Flush()
+	if r.closer != nil {
+		if cerr := r.closer.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+// Reader reads events from a recording.
+type Reader struct {
+	dec     *json.Decoder
+	version int
+}
+
+// NewReader returns a Reader for the recording in r.
+// The header is read and validated immediately.
+func NewReader(r io.Reader) (*Reader, error) {
+	dec := json.NewDecoder(r)
+	var header Header
+	if err := dec.Decode(&header); err != nil {
+		return nil, fmt.Errorf("error reading header: %v", err)
+	}
+	if header.Format != Format {
+		return nil, fmt.Errorf("unexpected format %q, expected %q", header.Format, Format)
+	}
+	// the events of version 1 have neither variant nor run,
+	// as if the command was executed once, and the runs
+	// of the versions before 3 are known by their events only.
+	if header.Version < 1 || header.Version > Version {
+		return nil, fmt.Errorf("unsupported recording version %d, expected %d", header.Version, Version)
+	}
+	return &Reader{dec: dec, version: header.Version}, nil
+}
+
+// Version returns the version of the recording format.
+func (r *Reader) Version() int {
+	return r.version
+}
+
+// Next returns the next event of the recording.
+// Returns io.EOF when there are no more events.
+func (r *Reader) Next() (Event, error) {
+	var e Event
+	if err := r.dec.Decode(&e); err != nil {
+		if errors.Is(err, io.EOF) {
+			return e, io.EOF
+		}
+		return e, fmt.Errorf("error reading event: %v", err)
+	}
+	return e, nil
+}
+
+// Capture holds the recorded events of a symbol
+// traced with an env matrix variant.
+type Capture struct {
+	Variant string
+	Symbol  string
+	// Runs holds the events of each run, the first being run 1.
+	Runs [][]Event
+	// PerTest is set when the syscalls were attributed to the tests.
+	PerTest bool
+}
+
+// ReadCaptures reads the events of the recording, grouping them
+// by variant and symbol, in the order they appear, and then by run.
+// The captures and their runs are the ones of the run start records,
+// which are not included in the events. The recordings before version 3
+// have no run start records, so the runs are the ones of their events:
+// those recorded before the runs were numbered belong to the first one.
+func ReadCaptures(r *Reader) ([]*Capture, error) {
+	var captures []*Capture
+	for {
+		e, err := r.Next()
+		if err == io.EOF {
+			return captures, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		started := r.version < 3 || e.Kind == KindRunStart
+		i := slices.IndexFunc(captures, func(c *Capture) bool {
+			return c.Variant == e.Variant && c.Symbol == e.Symbol
+		})
+		if i < 0 && started {
+			captures = append(captures, &Capture{Variant: e.Variant, Symbol: e.Symbol})
+			i = len(captures) - 1
+		}
+		run := max(e.Run, 1)
+		if started {
+			for len(captures[i].Runs) < run {
+				captures[i].Runs = append(captures[i].Runs, nil)
+			}
+		}
+		if i < 0 || len(captures[i].Runs) < run {
+			return nil, fmt.Errorf("event of run %d of %s recorded before the start of the run", run, e.Symbol)
+		}
+		c := captures[i]
+		if e.Kind == KindRunStart {
+			c.PerTest = c.PerTest || e.PerTest
+			continue
+		}
+		if e.Test != "" {
+			c.PerTest = true
+		}
+		c.Runs[run-1] = append(c.Runs[run-1], e)
+	}
+}
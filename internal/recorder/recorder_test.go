@@ -0,0 +1,177 @@
+package recorder
+
+import (
+	"bytes"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRecordAndRead(t *testing.T) {
+	events := []Event{
+		{
+			Symbol:    "main.main",
+			PID:       10,
+			TID:       11,
+			Timestamp: 1000,
+			SyscallID: 1,
+			Args:      []uint64{1, 2, 3, 4, 5, 6},
+		},
+		{
+			Symbol:    "main.doSomething",
+			PID:       10,
+			TID:       12,
+			Timestamp: 2000,
+			SyscallID: 0,
+			Test:      "TestSomething",
+			Variant:   "proxy",
+			Run:       2,
+		},
+	}
+
+	var buf bytes.Buffer
+	r, err := NewRecorder(&buf)
+	if err != nil {
+		t.Fatalf("NewRecorder() error = %v", err)
+	}
+	for _, e := range events {
+		if err := r.Record(e); err != nil {
+			t.Fatalf("Record() error = %v", err)
+		}
+	}
+	if err := r.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	reader, err := NewReader(&buf)
+	if err != nil {
+		t.Fatalf("NewReader() error = %v", err)
+	}
+	var got []Event
+	for {
+		e, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Next() error = %v", err)
+		}
+		got = append(got, e)
+	}
+	if !reflect.DeepEqual(got, events) {
+		t.Errorf("Next() = %v, want %v", got, events)
+	}
+}
+
+func TestNewReader(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		wantErr bool
+	}{
+		{
+			name:    "valid header",
+			input:   `{"format":"harpoon-events","version":3}`,
+			wantErr: false,
+		},
+		{
+			name:    "previous version",
+			input:   `{"format":"harpoon-events","version":1}`,
+			wantErr: false,
+		},
+		{
+			name:    "unsupported version",
+			input:   `{"format":"harpoon-events","version":99}`,
+			wantErr: true,
+		},
+		{
+			name:    "unexpected format",
+			input:   `{"format":"something-else","version":1}`,
+			wantErr: true,
+		},
+		{
+			name:    "empty file",
+			input:   "",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewReader(strings.NewReader(tt.input)); (err != nil) != tt.wantErr {
+				t.Errorf("NewReader() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestReadCaptures(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    []*Capture
+		wantErr bool
+	}{
+		{
+			name: "runs without events",
+			input: `{"format":"harpoon-events","version":3}
+{"kind":"run_start","symbol":"main.main","variant":"proxy","run":1,"perTest":true}
+{"symbol":"main.main","syscallId":1,"test":"TestMain","variant":"proxy","run":1}
+{"kind":"run_start","symbol":"main.main","variant":"proxy","run":2,"perTest":true}
+{"kind":"run_start","symbol":"main.idle","variant":"proxy","run":1}
+`,
+			want: []*Capture{
+				{
+					Variant: "proxy",
+					Symbol:  "main.main",
+					Runs: [][]Event{
+						{{Symbol: "main.main", SyscallID: 1, Test: "TestMain", Variant: "proxy", Run: 1}},
+						nil,
+					},
+					PerTest: true,
+				},
+				{
+					Variant: "proxy",
+					Symbol:  "main.idle",
+					Runs:    [][]Event{nil},
+				},
+			},
+		},
+		{
+			name: "runs of the events",
+			input: `{"format":"harpoon-events","version":1}
+{"symbol":"main.main","syscallId":1}
+{"symbol":"main.main","syscallId":2}
+`,
+			want: []*Capture{
+				{
+					Symbol: "main.main",
+					Runs:   [][]Event{{{Symbol: "main.main", SyscallID: 1}, {Symbol: "main.main", SyscallID: 2}}},
+				},
+			},
+		},
+		{
+			name: "event before the start of the run",
+			input: `{"format":"harpoon-events","version":3}
+{"kind":"run_start","symbol":"main.main","run":1}
+{"symbol":"main.main","syscallId":1,"run":2}
+`,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reader, err := NewReader(strings.NewReader(tt.input))
+			if err != nil {
+				t.Fatalf("NewReader() error = %v", err)
+			}
+			got, err := ReadCaptures(reader)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ReadCaptures() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ReadCaptures() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
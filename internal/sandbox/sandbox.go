@@ -0,0 +1,193 @@
+package sandbox
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"syscall"
+
+	"github.com/spf13/pflag"
+	"golang.org/x/sys/unix"
+)
+
+// loopback is the name of the loopback interface.
+const loopback = "lo"
+
+// flags of the command setting up the sandbox (see Args).
+const (
+	uidFlag      = "uid"
+	gidFlag      = "gid"
+	groupsFlag   = "groups"
+	readOnlyFlag = "ro-bind"
+	dirFlag      = "workdir"
+)
+
+// Options configures the sandbox the command is executed in.
+type Options struct {
+	// Credential, when set, is the user and group the command is executed as.
+	Credential *syscall.Credential
+	// ReadOnlyDirs are bind mounted read-only on themselves,
+	// so that the command can read but not change them.
+	ReadOnlyDirs []string
+	// Dir is the working directory of the command,
+	// entered once the directories are mounted.
+	Dir string
+}
+
+// Args returns the flags passing the options
+// to the command setting up the sandbox.
+func (o Options) Args() []string {
+	var args []string
+	if o.Credential != nil {
+		args = append(args,
+			"--"+uidFlag, strconv.FormatUint(uint64(o.Credential.Uid), 10),
+			"--"+gidFlag, strconv.FormatUint(uint64(o.Credential.Gid), 10),
+		)
+		for _, g := range o.Credential.Groups {
+			args = append(args, "--"+groupsFlag, strconv.FormatUint(uint64(g), 10))
+		}
+	}
+	for _, dir := range o.ReadOnlyDirs {
+		args = append(args, "--"+readOnlyFlag, dir)
+	}
+	if o.Dir != "" {
+		args = append(args, "--"+dirFlag, o.Dir)
+	}
+	return args
+}
+
+// AddFlags adds the flags built by Args to the flag set.
+func AddFlags(flags *pflag.FlagSet) {
+	flags.Int(uidFlag, -1, "User id the command is executed as")
+	flags.Int(gidFlag, -1, "Group id the command is executed as")
+	flags.IntSlice(groupsFlag, []int{}, "Supplementary groups of the command")
+	flags.StringArray(readOnlyFlag, []string{}, "Directory made read-only within the sandbox")
+	flags.String(dirFlag, "", "Working directory of the command")
+}
+
+// ParseFlags returns the options of the flags added by AddFlags, once parsed.
+func ParseFlags(flags *pflag.FlagSet) (Options, error) {
+	var o Options
+	uid, err := flags.GetInt(uidFlag)
+	if err != nil {
+		return o, err
+	}
+	gid, err := flags.GetInt(gidFlag)
+	if err != nil {
+		return o, err
+	}
+	groups, err := flags.GetIntSlice(groupsFlag)
+	if err != nil {
+		return o, err
+	}
+	if (uid < 0) != (gid < 0) {
+		return o, errors.New("the uid and gid must be set together")
+	}
+	if uid >= 0 {
+		o.Credential = &syscall.Credential{
+			Uid: uint32(uid),
+			Gid: uint32(gid),
+		}
+		for _, g := range groups {
+			o.Credential.Groups = append(o.Credential.Groups, uint32(g))
+		}
+	}
+	if o.ReadOnlyDirs, err = flags.GetStringArray(readOnlyFlag); err != nil {
+		return o, err
+	}
+	if len(o.ReadOnlyDirs) == 0 {
+		o.ReadOnlyDirs = nil
+	}
+	if o.Dir, err = flags.GetString(dirFlag); err != nil {
+		return o, err
+	}
+	return o, nil
+}
+
+// Setup prepares the namespaces the command is executed in:
+// it brings the loopback interface of the new network namespace up,
+// mounts a new /proc matching the new pid namespace and the read-only
+// directories, then drops the privileges and enters the working directory.
+// It must be called from within the namespaces, with root privileges.
+func Setup(opts Options) error {
+	if err := loopbackUp(); err != nil {
+		return err
+	}
+	if err := syscall.Mount("proc", "/proc", "proc", syscall.MS_NOSUID|syscall.MS_NODEV|syscall.MS_NOEXEC, ""); err != nil {
+		return fmt.Errorf("error mounting /proc: %v", err)
+	}
+	for _, dir := range opts.ReadOnlyDirs {
+		if err := bindReadOnly(dir); err != nil {
+			return err
+		}
+	}
+	if err := DropPrivileges(opts.Credential); err != nil {
+		return err
+	}
+	// the working directory could be one of the mounted ones,
+	// entered before mounting it.
+	if opts.Dir != "" {
+		if err := syscall.Chdir(opts.Dir); err != nil {
+			return fmt.Errorf("error changing directory to %s: %v", opts.Dir, err)
+		}
+	}
+	return nil
+}
+
+// bindReadOnly bind mounts the directory read-only on itself.
+// The read-only flag can be set only by remounting the bind mount.
+func bindReadOnly(dir string) error {
+	if err := syscall.Mount(dir, dir, "", syscall.MS_BIND|syscall.MS_REC, ""); err != nil {
+		return fmt.Errorf("error bind mounting %s: %v", dir, err)
+	}
+	if err := syscall.Mount("", dir, "", syscall.MS_BIND|syscall.MS_REMOUNT|syscall.MS_RDONLY, ""); err != nil {
+		return fmt.Errorf("error remounting %s read-only: %v", dir, err)
+	}
+	return nil
+}
+
+// loopbackUp brings the loopback interface up,
+// since new network namespaces have it down.
+func loopbackUp() error {
+	fd, err := unix.Socket(unix.AF_INET, unix.SOCK_DGRAM|unix.SOCK_CLOEXEC, 0)
+	if err != nil {
+		return fmt.Errorf("error creating socket: %v", err)
+	}
+	defer unix.Close(fd)
+
+	ifr, err := unix.NewIfreq(loopback)
+	if err != nil {
+		return fmt.Errorf("error looking up %s interface: %v", loopback, err)
+	}
+	if err := unix.IoctlIfreq(fd, unix.SIOCGIFFLAGS, ifr); err != nil {
+		return fmt.Errorf("error getting %s interface flags: %v", loopback, err)
+	}
+	ifr.SetUint16(ifr.Uint16() | unix.IFF_UP)
+	if err := unix.IoctlIfreq(fd, unix.SIOCSIFFLAGS, ifr); err != nil {
+		return fmt.Errorf("error bringing %s interface up: %v", loopback, err)
+	}
+	return nil
+}
+
+// DropPrivileges switches the process to the given credential.
+// Since the namespaces must be set up as root, the command
+// can't rely on exec to drop its privileges.
+func DropPrivileges(cred *syscall.Credential) error {
+	if cred == nil {
+		return nil
+	}
+	groups := make([]int, len(cred.Groups))
+	for i, g := range cred.Groups {
+		groups[i] = int(g)
+	}
+	if err := syscall.Setgroups(groups); err != nil {
+		return fmt.Errorf("error setting groups: %v", err)
+	}
+	if err := syscall.Setgid(int(cred.Gid)); err != nil {
+		return fmt.Errorf("error setting gid %d: %v", cred.Gid, err)
+	}
+	if err := syscall.Setuid(int(cred.Uid)); err != nil {
+		return fmt.Errorf("error setting uid %d: %v", cred.Uid, err)
+	}
+	return nil
+}
@@ -0,0 +1,95 @@
+package sandbox
+
+import (
+	"reflect"
+	"syscall"
+	"testing"
+
+	"github.com/spf13/pflag"
+)
+
+func TestOptionsArgs(t *testing.T) {
+	tests := []struct {
+		name string
+		opts Options
+		want []string
+	}{
+		{
+			name: "no options",
+			opts: Options{},
+			want: nil,
+		},
+		{
+			name: "credential",
+			opts: Options{
+				Credential: &syscall.Credential{Uid: 1000, Gid: 100, Groups: []uint32{10, 20}},
+			},
+			want: []string{"--uid", "1000", "--gid", "100", "--groups", "10", "--groups", "20"},
+		},
+		{
+			name: "package directory",
+			opts: Options{
+				ReadOnlyDirs: []string{"/src/app/pkg", "/src/app/testdata"},
+				Dir:          "/src/app/pkg",
+			},
+			want: []string{"--ro-bind", "/src/app/pkg", "--ro-bind", "/src/app/testdata", "--workdir", "/src/app/pkg"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args := tt.opts.Args()
+			if !reflect.DeepEqual(args, tt.want) {
+				t.Errorf("Args() = %v, want %v", args, tt.want)
+			}
+
+			// the options are the same once parsed.
+			flags := pflag.NewFlagSet("sandbox", pflag.ContinueOnError)
+			AddFlags(flags)
+			if err := flags.Parse(args); err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+			got, err := ParseFlags(flags)
+			if err != nil {
+				t.Fatalf("ParseFlags() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.opts) {
+				t.Errorf("ParseFlags() = %+v, want %+v", got, tt.opts)
+			}
+		})
+	}
+}
+
+func TestParseFlags(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []string
+		wantErr bool
+	}{
+		{
+			name: "uid and gid",
+			args: []string{"--uid", "0", "--gid", "0"},
+		},
+		{
+			name:    "uid without gid",
+			args:    []string{"--uid", "1000"},
+			wantErr: true,
+		},
+		{
+			name:    "gid without uid",
+			args:    []string{"--gid", "1000"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			flags := pflag.NewFlagSet("sandbox", pflag.ContinueOnError)
+			AddFlags(flags)
+			if err := flags.Parse(tt.args); err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+			if _, err := ParseFlags(flags); (err != nil) != tt.wantErr {
+				t.Errorf("ParseFlags() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
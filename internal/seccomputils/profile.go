@@ -0,0 +1,163 @@
+package seccomputils
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"syscall"
+
+	"github.com/alegrey91/harpoon/internal/syscallutils"
+	seccomp "github.com/seccomp/libseccomp-golang"
+)
+
+// actions that let the system call through.
+var allowActions = []string{"SCMP_ACT_ALLOW", "SCMP_ACT_LOG"}
+
+// startupSyscalls are let through by the installed filter whatever the profile says:
+// the command must be executed, and the Go runtime started, before running its code.
+// They are still reported by Blocked when the profile denies them.
+var startupSyscalls = slices.Concat([]string{"execve"}, syscallutils.MinDynamicGoSyscallSet, syscallutils.MinStaticGoSyscallSet)
+
+// verify actions applied to the system calls denied by the profile.
+const (
+	VerifyActionLog   = "log"
+	VerifyActionErrno = "errno"
+)
+
+// Profile is a seccomp profile in the OCI/docker JSON format.
+type Profile struct {
+	DefaultAction string        `json:"defaultAction"`
+	Architectures []string      `json:"architectures,omitempty"`
+	Syscalls      []ProfileRule `json:"syscalls"`
+}
+
+// ProfileRule is the action applied to a list of system calls.
+type ProfileRule struct {
+	Names  []string `json:"names"`
+	Action string   `json:"action"`
+}
+
+// LoadProfile reads the seccomp profile from the given path.
+func LoadProfile(path string) (*Profile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading profile %s: %v", path, err)
+	}
+	var profile Profile
+	if err := json.Unmarshal(data, &profile); err != nil {
+		return nil, fmt.Errorf("error parsing profile %s: %v", path, err)
+	}
+	if profile.DefaultAction == "" {
+		return nil, fmt.Errorf("error parsing profile %s: missing defaultAction", path)
+	}
+	return &profile, nil
+}
+
+// Allows returns true if the profile lets the system call through.
+// The arguments conditions are not taken into account,
+// so the last rule naming the system call decides.
+func (p *Profile) Allows(syscall string) bool {
+	allowed := slices.Contains(allowActions, p.DefaultAction)
+	for _, rule := range p.Syscalls {
+		if slices.Contains(rule.Names, syscall) {
+			allowed = slices.Contains(allowActions, rule.Action)
+		}
+	}
+	return allowed
+}
+
+// Blocked returns the names of the system calls
+// the profile would have blocked, without duplicates.
+func (p *Profile) Blocked(syscalls []uint32) ([]string, error) {
+	var blocked []string
+	for _, s := range syscalls {
+		name, err := seccomp.ScmpSyscall(s).GetName()
+		if err != nil {
+			return nil, fmt.Errorf("error finding syscall %d: %v", s, err)
+		}
+		if !p.Allows(name) && !slices.Contains(blocked, name) {
+			blocked = append(blocked, name)
+		}
+	}
+	return blocked, nil
+}
+
+// Install loads the profile on the current process (and its children),
+// applying the verify action to the system calls it denies:
+// log them (letting them through), or fail them with EPERM.
+// The startup system calls are always let through (see startupSyscalls).
+// The no_new_privs bit is set, so this doesn't require privileges.
+func (p *Profile) Install(verifyAction string) error {
+	var denyAction seccomp.ScmpAction
+	switch verifyAction {
+	case VerifyActionLog:
+		denyAction = seccomp.ActLog
+	case VerifyActionErrno:
+		denyAction = seccomp.ActErrno.SetReturnCode(int16(syscall.EPERM))
+	default:
+		return fmt.Errorf("unknown verify action %q, expected %s or %s", verifyAction, VerifyActionLog, VerifyActionErrno)
+	}
+
+	defaultAllowed, rules := p.filterRules()
+	defaultAction := denyAction
+	if defaultAllowed {
+		defaultAction = seccomp.ActAllow
+	}
+	filter, err := seccomp.NewFilter(defaultAction)
+	if err != nil {
+		return fmt.Errorf("error creating seccomp filter: %v", err)
+	}
+	defer filter.Release()
+
+	for _, rule := range rules {
+		id, err := seccomp.GetSyscallFromName(rule.name)
+		if err != nil {
+			// the system call doesn't exist on this architecture.
+			continue
+		}
+		action := denyAction
+		if rule.allowed {
+			action = seccomp.ActAllow
+		}
+		if err := filter.AddRule(id, action); err != nil {
+			return fmt.Errorf("error adding rule for %s: %v", rule.name, err)
+		}
+	}
+
+	if err := filter.Load(); err != nil {
+		return fmt.Errorf("error loading seccomp filter: %v", err)
+	}
+	return nil
+}
+
+// filterRule is the rule of the installed filter for a system call.
+type filterRule struct {
+	name    string
+	allowed bool
+}
+
+// filterRules returns whether the installed filter lets the system calls
+// through by default, and the rules of the ones differing from the default.
+func (p *Profile) filterRules() (bool, []filterRule) {
+	defaultAllowed := slices.Contains(allowActions, p.DefaultAction)
+	var names []string
+	for _, rule := range p.Syscalls {
+		names = append(names, rule.Names...)
+	}
+	names = append(names, startupSyscalls...)
+
+	var rules []filterRule
+	seen := make(map[string]bool)
+	for _, name := range names {
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+		allowed := p.Allows(name) || slices.Contains(startupSyscalls, name)
+		if allowed != defaultAllowed {
+			rules = append(rules, filterRule{name: name, allowed: allowed})
+		}
+	}
+	return defaultAllowed, rules
+}
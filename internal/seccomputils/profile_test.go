@@ -0,0 +1,190 @@
+package seccomputils
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"testing"
+)
+
+func TestLoadProfile(t *testing.T) {
+	dir := t.TempDir()
+	profile, err := BuildProfile([]string{"read", "write"}, []string{"SCMP_ARCH_X86_64"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	valid := filepath.Join(dir, "valid.json")
+	if err := os.WriteFile(valid, []byte(profile), 0644); err != nil {
+		t.Fatal(err)
+	}
+	invalid := filepath.Join(dir, "invalid.json")
+	if err := os.WriteFile(invalid, []byte(`{"syscalls": []}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		path    string
+		want    *Profile
+		wantErr bool
+	}{
+		{
+			name: "generated profile",
+			path: valid,
+			want: &Profile{
+				DefaultAction: "SCMP_ACT_ERRNO",
+				Architectures: []string{"SCMP_ARCH_X86_64"},
+				Syscalls: []ProfileRule{
+					{
+						Names:  []string{"read", "write"},
+						Action: "SCMP_ACT_ALLOW",
+					},
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name:    "missing default action",
+			path:    invalid,
+			want:    nil,
+			wantErr: true,
+		},
+		{
+			name:    "missing file",
+			path:    filepath.Join(dir, "missing.json"),
+			want:    nil,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := LoadProfile(tt.path)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("LoadProfile() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("LoadProfile() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestProfileBlocked(t *testing.T) {
+	tests := []struct {
+		name     string
+		profile  Profile
+		syscalls []uint32
+		want     []string
+	}{
+		{
+			name: "allow list",
+			profile: Profile{
+				DefaultAction: "SCMP_ACT_ERRNO",
+				Syscalls: []ProfileRule{
+					{Names: []string{"read", "write"}, Action: "SCMP_ACT_ALLOW"},
+				},
+			},
+			syscalls: []uint32{0, 1, 2, 3, 2},
+			want:     []string{"open", "close"},
+		},
+		{
+			name: "deny list",
+			profile: Profile{
+				DefaultAction: "SCMP_ACT_ALLOW",
+				Syscalls: []ProfileRule{
+					{Names: []string{"open"}, Action: "SCMP_ACT_KILL"},
+				},
+			},
+			syscalls: []uint32{0, 1, 2, 3},
+			want:     []string{"open"},
+		},
+		{
+			name: "last rule wins",
+			profile: Profile{
+				DefaultAction: "SCMP_ACT_ERRNO",
+				Syscalls: []ProfileRule{
+					{Names: []string{"read", "write"}, Action: "SCMP_ACT_ALLOW"},
+					{Names: []string{"write"}, Action: "SCMP_ACT_ERRNO"},
+				},
+			},
+			syscalls: []uint32{0, 1},
+			want:     []string{"write"},
+		},
+		{
+			name: "nothing blocked",
+			profile: Profile{
+				DefaultAction: "SCMP_ACT_ERRNO",
+				Syscalls: []ProfileRule{
+					{Names: []string{"read"}, Action: "SCMP_ACT_LOG"},
+				},
+			},
+			syscalls: []uint32{0},
+			want:     nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.profile.Blocked(tt.syscalls)
+			if err != nil {
+				t.Fatalf("Blocked() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Blocked() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestProfileFilterRules(t *testing.T) {
+	tests := []struct {
+		name           string
+		profile        Profile
+		defaultAllowed bool
+		want           []filterRule
+	}{
+		{
+			name: "allow list",
+			profile: Profile{
+				DefaultAction: "SCMP_ACT_ERRNO",
+				Syscalls: []ProfileRule{
+					{Names: []string{"read", "write", "read"}, Action: "SCMP_ACT_ALLOW"},
+					{Names: []string{"write"}, Action: "SCMP_ACT_ERRNO"},
+				},
+			},
+			want: []filterRule{{name: "read", allowed: true}},
+		},
+		{
+			name: "deny list",
+			profile: Profile{
+				DefaultAction: "SCMP_ACT_ALLOW",
+				Syscalls: []ProfileRule{
+					{Names: []string{"open", "execve", "mmap"}, Action: "SCMP_ACT_KILL"},
+				},
+			},
+			defaultAllowed: true,
+			want:           []filterRule{{name: "open"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defaultAllowed, rules := tt.profile.filterRules()
+			if defaultAllowed != tt.defaultAllowed {
+				t.Errorf("filterRules() default allowed = %v, want %v", defaultAllowed, tt.defaultAllowed)
+			}
+			// the startup system calls are allowed by the filter.
+			var got []filterRule
+			for _, rule := range rules {
+				if !slices.Contains(startupSyscalls, rule.name) {
+					got = append(got, rule)
+				} else if !rule.allowed {
+					t.Errorf("filterRules() denies the startup system call %s", rule.name)
+				}
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("filterRules() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
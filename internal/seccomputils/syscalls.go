@@ -22,6 +22,19 @@ func Print(writer io.Writer, syscalls []uint32) error {
 	return nil
 }
 
+// Names converts the syscall ids to their names.
+func Names(syscalls []uint32) ([]string, error) {
+	names := make([]string, 0, len(syscalls))
+	for _, s := range syscalls {
+		name, err := seccomp.ScmpSyscall(s).GetName()
+		if err != nil {
+			return nil, fmt.Errorf("error finding syscall %d: %v", s, err)
+		}
+		names = append(names, name)
+	}
+	return names, nil
+}
+
 // IsValidSyscall returns true if a valid system call was passed to the function.
 // Returns false otherwise.
 func IsValidSyscall(syscall string) bool {
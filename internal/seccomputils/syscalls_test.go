@@ -2,6 +2,7 @@ package seccomputils
 
 import (
 	"bytes"
+	"reflect"
 	"testing"
 )
 
@@ -47,6 +48,40 @@ func TestPrint(t *testing.T) {
 	}
 }
 
+func TestNames(t *testing.T) {
+	tests := []struct {
+		name     string
+		syscalls []uint32
+		want     []string
+		wantErr  bool
+	}{
+		{
+			name:     "valid syscalls",
+			syscalls: []uint32{0, 1, 3},
+			want:     []string{"read", "write", "close"},
+			wantErr:  false,
+		},
+		{
+			name:     "invalid syscall",
+			syscalls: []uint32{0, 99999},
+			want:     nil,
+			wantErr:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Names(tt.syscalls)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Names() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Names() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
 func TestIsValidSyscall(t *testing.T) {
 	type args struct {
 		syscall string
@@ -0,0 +1,99 @@
+package stability
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"sort"
+
+	"gopkg.in/yaml.v2"
+)
+
+// FileSuffix is appended to the name of the metadata file
+// to get the name of the file holding its stats.
+const FileSuffix = ".stability.yml"
+
+// Stats holds how many of the runs each syscall appeared in.
+type Stats struct {
+	Runs     int            `yaml:"runs"`
+	Syscalls map[string]int `yaml:"syscalls"`
+}
+
+// NewStats returns empty stats.
+func NewStats() *Stats {
+	return &Stats{
+		Syscalls: make(map[string]int),
+	}
+}
+
+// AddRun accounts the syscalls of a single run.
+// Duplicates are counted once.
+func (s *Stats) AddRun(syscalls []string) {
+	s.Runs++
+	var seen []string
+	for _, syscall := range syscalls {
+		if slices.Contains(seen, syscall) {
+			continue
+		}
+		seen = append(seen, syscall)
+		s.Syscalls[syscall]++
+	}
+}
+
+// Merge adds the runs of other to the stats.
+func (s *Stats) Merge(other *Stats) {
+	s.Runs += other.Runs
+	for syscall, count := range other.Syscalls {
+		s.Syscalls[syscall] += count
+	}
+}
+
+// Ratio returns the ratio of runs the syscall appeared in.
+// Returns false if the syscall is unknown.
+func (s *Stats) Ratio(syscall string) (float64, bool) {
+	count, ok := s.Syscalls[syscall]
+	if !ok || s.Runs == 0 {
+		return 0, false
+	}
+	return float64(count) / float64(s.Runs), true
+}
+
+// Flaky returns the syscalls that didn't appear in every run, sorted.
+func (s *Stats) Flaky() []string {
+	var flaky []string
+	for syscall, count := range s.Syscalls {
+		if count < s.Runs {
+			flaky = append(flaky, syscall)
+		}
+	}
+	sort.Strings(flaky)
+	return flaky
+}
+
+// Load reads the stats from the given file.
+func Load(path string) (*Stats, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading stats %s: %w", path, err)
+	}
+	stats := NewStats()
+	if err := yaml.Unmarshal(data, stats); err != nil {
+		return nil, fmt.Errorf("error parsing stats %s: %v", path, err)
+	}
+	if stats.Syscalls == nil {
+		stats.Syscalls = make(map[string]int)
+	}
+	return stats, nil
+}
+
+// Save writes the stats to the given file.
+func (s *Stats) Save(path string) error {
+	data, err := yaml.Marshal(s)
+	if err != nil {
+		return fmt.Errorf("error encoding stats: %v", err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("error writing stats %s: %v", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+package stability
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestStats(t *testing.T) {
+	stats := NewStats()
+	stats.AddRun([]string{"read", "write", "read"})
+	stats.AddRun([]string{"read", "openat"})
+	stats.AddRun([]string{"read", "write"})
+
+	if stats.Runs != 3 {
+		t.Errorf("Runs = %d, want 3", stats.Runs)
+	}
+	wantSyscalls := map[string]int{"read": 3, "write": 2, "openat": 1}
+	if !reflect.DeepEqual(stats.Syscalls, wantSyscalls) {
+		t.Errorf("Syscalls = %v, want %v", stats.Syscalls, wantSyscalls)
+	}
+	if got, want := stats.Flaky(), []string{"openat", "write"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Flaky() = %v, want %v", got, want)
+	}
+
+	tests := []struct {
+		syscall string
+		want    float64
+		wantOk  bool
+	}{
+		{syscall: "read", want: 1, wantOk: true},
+		{syscall: "openat", want: 1.0 / 3, wantOk: true},
+		{syscall: "close", want: 0, wantOk: false},
+	}
+	for _, tt := range tests {
+		got, ok := stats.Ratio(tt.syscall)
+		if got != tt.want || ok != tt.wantOk {
+			t.Errorf("Ratio(%s) = %v, %v, want %v, %v", tt.syscall, got, ok, tt.want, tt.wantOk)
+		}
+	}
+}
+
+func TestSaveLoadMerge(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "main_main"+FileSuffix)
+	stats := NewStats()
+	stats.AddRun([]string{"read", "write"})
+	stats.AddRun([]string{"read"})
+	if err := stats.Save(path); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	loaded, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if !reflect.DeepEqual(loaded, stats) {
+		t.Errorf("Load() = %v, want %v", loaded, stats)
+	}
+
+	loaded.Merge(stats)
+	if loaded.Runs != 4 || loaded.Syscalls["read"] != 4 || loaded.Syscalls["write"] != 2 {
+		t.Errorf("Merge() = %v, want 4 runs, read 4, write 2", loaded)
+	}
+}
@@ -0,0 +1,90 @@
+package syscallutils
+
+import "fmt"
+
+// IOUringOpPrefix is used to tell apart io_uring operations
+// from system calls within the harpoon metadata files.
+// e.g. io_uring:OPENAT
+const IOUringOpPrefix = "io_uring:"
+
+// IOUringSyscalls are the system calls used to set up and drive io_uring.
+// Their presence means the operations submitted through the rings
+// are executed by the kernel without being filtered by seccomp.
+var IOUringSyscalls = []string{
+	"io_uring_setup",
+	"io_uring_enter",
+	"io_uring_register",
+}
+
+// Names of the io_uring operations, indexed by opcode.
+// Taken from enum io_uring_op in include/uapi/linux/io_uring.h
+var ioUringOps = []string{
+	"NOP",
+	"READV",
+	"WRITEV",
+	"FSYNC",
+	"READ_FIXED",
+	"WRITE_FIXED",
+	"POLL_ADD",
+	"POLL_REMOVE",
+	"SYNC_FILE_RANGE",
+	"SENDMSG",
+	"RECVMSG",
+	"TIMEOUT",
+	"TIMEOUT_REMOVE",
+	"ACCEPT",
+	"ASYNC_CANCEL",
+	"LINK_TIMEOUT",
+	"CONNECT",
+	"FALLOCATE",
+	"OPENAT",
+	"CLOSE",
+	"FILES_UPDATE",
+	"STATX",
+	"READ",
+	"WRITE",
+	"FADVISE",
+	"MADVISE",
+	"SEND",
+	"RECV",
+	"OPENAT2",
+	"EPOLL_CTL",
+	"SPLICE",
+	"PROVIDE_BUFFERS",
+	"REMOVE_BUFFERS",
+	"TEE",
+	"SHUTDOWN",
+	"RENAMEAT",
+	"UNLINKAT",
+	"MKDIRAT",
+	"SYMLINKAT",
+	"LINKAT",
+	"MSG_RING",
+	"FSETXATTR",
+	"SETXATTR",
+	"FGETXATTR",
+	"GETXATTR",
+	"SOCKET",
+	"URING_CMD",
+	"SEND_ZC",
+	"SENDMSG_ZC",
+	"READ_MULTISHOT",
+	"WAITID",
+	"FUTEX_WAIT",
+	"FUTEX_WAKE",
+	"FUTEX_WAITV",
+	"FIXED_FD_INSTALL",
+	"FTRUNCATE",
+	"BIND",
+	"LISTEN",
+}
+
+// IOUringOpName returns the name of the io_uring operation
+// from its opcode.
+// e.g. opcode=18 -> OPENAT
+func IOUringOpName(opcode uint32) string {
+	if int(opcode) < len(ioUringOps) {
+		return ioUringOps[opcode]
+	}
+	return fmt.Sprintf("UNKNOWN_%d", opcode)
+}
@@ -0,0 +1,50 @@
+package syscallutils
+
+import "testing"
+
+func TestIOUringOpName(t *testing.T) {
+	type args struct {
+		opcode uint32
+	}
+	tests := []struct {
+		name string
+		args args
+		want string
+	}{
+		{
+			name: "nop",
+			args: args{
+				opcode: 0,
+			},
+			want: "NOP",
+		},
+		{
+			name: "openat",
+			args: args{
+				opcode: 18,
+			},
+			want: "OPENAT",
+		},
+		{
+			name: "connect",
+			args: args{
+				opcode: 16,
+			},
+			want: "CONNECT",
+		},
+		{
+			name: "unknown opcode",
+			args: args{
+				opcode: 255,
+			},
+			want: "UNKNOWN_255",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IOUringOpName(tt.args.opcode); got != tt.want {
+				t.Errorf("IOUringOpName() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,257 @@
+package testgraph
+
+import (
+	"fmt"
+	"go/types"
+	"slices"
+	"sort"
+	"strings"
+
+	"golang.org/x/tools/go/callgraph"
+	"golang.org/x/tools/go/callgraph/cha"
+	"golang.org/x/tools/go/packages"
+	"golang.org/x/tools/go/ssa"
+	"golang.org/x/tools/go/ssa/ssautil"
+)
+
+// Options configures the analysis.
+type Options struct {
+	// Dir is the directory the patterns are relative to.
+	Dir string
+	// Patterns are the packages to be analyzed (eg. ./...).
+	Patterns []string
+	// Module is the path prefix of the functions to be reported.
+	Module string
+	// MaxDepth is the max number of calls between a test
+	// and the functions reported, 0 means no limit.
+	MaxDepth int
+	// BuildFlags are passed to the go tool loading the packages (eg. -tags=integration).
+	BuildFlags []string
+	// Env is the environment of the go tool, ours when empty.
+	Env []string
+}
+
+// Reach is a module function reachable from the tests of a package.
+type Reach struct {
+	// Symbol is the name of the function as found in the ELF symbols.
+	Symbol string
+	// Package is the import path of the package of the function.
+	Package string
+	// TestPackage is the import path of the package whose tests
+	// reach the function. External tests (package x_test) belong to x.
+	TestPackage string
+	// Tests are the tests reaching the function, sorted.
+	Tests []string
+	// Path is the shortest chain of calls from one of the tests
+	// to the function, both included.
+	Path []string
+}
+
+// Analyze builds the call graph of the packages, including their tests,
+// and returns the module functions reachable from the Test functions
+// of each package, sorted by test package and symbol.
+// The graph is built with Class Hierarchy Analysis, so the calls
+// through interfaces reach every method implementing them.
+func Analyze(opts Options) ([]Reach, error) {
+	cfg := &packages.Config{
+		Mode:       packages.LoadAllSyntax,
+		Dir:        opts.Dir,
+		Tests:      true,
+		BuildFlags: opts.BuildFlags,
+		Env:        opts.Env,
+	}
+	pkgs, err := packages.Load(cfg, opts.Patterns...)
+	if err != nil {
+		return nil, fmt.Errorf("error loading packages: %v", err)
+	}
+	var loadErrs []string
+	packages.Visit(pkgs, nil, func(pkg *packages.Package) {
+		for _, err := range pkg.Errors {
+			loadErrs = append(loadErrs, err.Error())
+		}
+	})
+	if len(loadErrs) > 0 {
+		return nil, fmt.Errorf("error loading packages: %s", strings.Join(loadErrs, "; "))
+	}
+
+	// only the functions of the analyzed packages are built,
+	// so the calls made through their dependencies are not followed.
+	prog, ssaPkgs := ssautil.Packages(pkgs, ssa.InstantiateGenerics)
+	prog.Build()
+	graph := cha.CallGraph(prog)
+	graph.DeleteSyntheticNodes()
+
+	type key struct {
+		testPackage string
+		symbol      string
+	}
+	reached := make(map[key]*Reach)
+	for _, test := range testFunctions(ssaPkgs) {
+		node := graph.Nodes[test]
+		if node == nil {
+			continue
+		}
+		testPackage := strings.TrimSuffix(test.Pkg.Pkg.Path(), "_test")
+		visit(node, opts, func(fn *ssa.Function, path []string) {
+			k := key{testPackage: testPackage, symbol: Symbol(fn)}
+			r, ok := reached[k]
+			if !ok {
+				r = &Reach{
+					Symbol:      k.symbol,
+					Package:     fn.Pkg.Pkg.Path(),
+					TestPackage: testPackage,
+					Path:        path,
+				}
+				reached[k] = r
+			}
+			if !slices.Contains(r.Tests, test.Name()) {
+				r.Tests = append(r.Tests, test.Name())
+			}
+			// keep the shortest path among the tests.
+			if len(path) < len(r.Path) {
+				r.Path = path
+			}
+		})
+	}
+
+	result := make([]Reach, 0, len(reached))
+	for _, r := range reached {
+		sort.Strings(r.Tests)
+		result = append(result, *r)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].TestPackage != result[j].TestPackage {
+			return result[i].TestPackage < result[j].TestPackage
+		}
+		return result[i].Symbol < result[j].Symbol
+	})
+	return result, nil
+}
+
+// visit walks the call graph breadth-first from the test node,
+// calling found with the module functions reached and the path to them.
+func visit(root *callgraph.Node, opts Options, found func(fn *ssa.Function, path []string)) {
+	type item struct {
+		node *callgraph.Node
+		path []string
+	}
+	seen := map[*callgraph.Node]bool{root: true}
+	queue := []item{{node: root, path: []string{Symbol(root.Func)}}}
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+		depth := len(current.path) - 1
+		if opts.MaxDepth > 0 && depth >= opts.MaxDepth {
+			continue
+		}
+		for _, edge := range current.node.Out {
+			callee := edge.Callee
+			if seen[callee] || callee.Func == nil {
+				continue
+			}
+			seen[callee] = true
+			path := append(append([]string{}, current.path...), Symbol(callee.Func))
+			if fn := origin(callee.Func); isModuleFunction(fn, opts.Module) {
+				found(fn, path)
+			}
+			queue = append(queue, item{node: callee, path: path})
+		}
+	}
+}
+
+// testFunctions returns the Test functions of the packages.
+func testFunctions(pkgs []*ssa.Package) []*ssa.Function {
+	var tests []*ssa.Function
+	for _, pkg := range pkgs {
+		if pkg == nil {
+			continue
+		}
+		for _, member := range pkg.Members {
+			fn, ok := member.(*ssa.Function)
+			if ok && isTestFunction(fn) {
+				tests = append(tests, fn)
+			}
+		}
+	}
+	sort.Slice(tests, func(i, j int) bool {
+		return tests[i].String() < tests[j].String()
+	})
+	return tests
+}
+
+// isTestFunction returns true for the func TestXxx(*testing.T) functions.
+func isTestFunction(fn *ssa.Function) bool {
+	if !strings.HasPrefix(fn.Name(), "Test") || fn.Name() == "TestMain" {
+		return false
+	}
+	params := fn.Signature.Params()
+	if params.Len() != 1 || fn.Signature.Results().Len() != 0 {
+		return false
+	}
+	return types.TypeString(params.At(0).Type(), nil) == "*testing.T"
+}
+
+// origin returns the generic function the instance is instantiated from,
+// or the function itself when it isn't an instance.
+func origin(fn *ssa.Function) *ssa.Function {
+	if o := fn.Origin(); o != nil {
+		return o
+	}
+	return fn
+}
+
+// isModuleFunction returns true for the named functions (and methods)
+// of the module, declared outside of the test files.
+func isModuleFunction(fn *ssa.Function, module string) bool {
+	if fn.Pkg == nil || fn.Parent() != nil || fn.Synthetic != "" {
+		return false
+	}
+	path := fn.Pkg.Pkg.Path()
+	if path != module && !strings.HasPrefix(path, module+"/") {
+		return false
+	}
+	pos := fn.Prog.Fset.Position(fn.Pos())
+	return !strings.HasSuffix(pos.Filename, "_test.go")
+}
+
+// Symbol returns the name of the function as found in the ELF symbols
+// (eg. github.com/user/project/pkg.(*Type).Method).
+// The instances of the generic functions are named after their origin,
+// with the type parameters elided (eg. pkg.Map[...]): the symbols
+// of the binary are compared once elided (see elfreader.ElideTypeArgs).
+func Symbol(fn *ssa.Function) string {
+	fn = origin(fn)
+	if fn.Pkg == nil {
+		return fn.String()
+	}
+	pkg := fn.Pkg.Pkg.Path()
+	if parent := fn.Parent(); parent != nil {
+		// anonymous functions are named after their parent,
+		// eg. pkg.Func$1 -> pkg.Func.func1
+		return Symbol(parent) + strings.Replace(strings.TrimPrefix(fn.Name(), parent.Name()), "$", ".func", 1)
+	}
+	recv := fn.Signature.Recv()
+	if recv == nil {
+		if fn.TypeParams().Len() > 0 {
+			return pkg + "." + fn.Name() + "[...]"
+		}
+		return pkg + "." + fn.Name()
+	}
+	recvType := recv.Type()
+	pointer := false
+	if ptr, ok := recvType.(*types.Pointer); ok {
+		pointer = true
+		recvType = ptr.Elem()
+	}
+	typeName := types.TypeString(recvType, func(*types.Package) string { return "" })
+	if named, ok := recvType.(*types.Named); ok {
+		typeName = named.Obj().Name()
+		if named.TypeParams().Len() > 0 {
+			typeName += "[...]"
+		}
+	}
+	if pointer {
+		return fmt.Sprintf("%s.(*%s).%s", pkg, typeName, fn.Name())
+	}
+	return fmt.Sprintf("%s.%s.%s", pkg, typeName, fn.Name())
+}
@@ -0,0 +1,161 @@
+package testgraph
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/alegrey91/harpoon/internal/testutil"
+)
+
+func TestAnalyze(t *testing.T) {
+	dir := testutil.ExtractArchive(t, "testdata/module.txtar")
+	tests := []struct {
+		name     string
+		maxDepth int
+		want     []Reach
+	}{
+		{
+			name: "no limit",
+			want: []Reach{
+				{
+					Symbol:      "example.com/app/pkg/store.(*Cache[...]).Put",
+					Package:     "example.com/app/pkg/store",
+					TestPackage: "example.com/app/pkg/store",
+					Tests:       []string{"TestGet"},
+					Path: []string{
+						"example.com/app/pkg/store.TestGet",
+						"example.com/app/pkg/store.(*Cache[...]).Put",
+					},
+				},
+				{
+					Symbol:      "example.com/app/pkg/store.(*memory).Get",
+					Package:     "example.com/app/pkg/store",
+					TestPackage: "example.com/app/pkg/store",
+					Tests:       []string{"TestGet"},
+					Path: []string{
+						"example.com/app/pkg/store.TestGet",
+						"example.com/app/pkg/store.Get",
+						"example.com/app/pkg/store.(*memory).Get",
+					},
+				},
+				{
+					Symbol:      "example.com/app/pkg/store.First[...]",
+					Package:     "example.com/app/pkg/store",
+					TestPackage: "example.com/app/pkg/store",
+					Tests:       []string{"TestGet"},
+					Path: []string{
+						"example.com/app/pkg/store.TestGet",
+						"example.com/app/pkg/store.First[...]",
+					},
+				},
+				{
+					Symbol:      "example.com/app/pkg/store.Get",
+					Package:     "example.com/app/pkg/store",
+					TestPackage: "example.com/app/pkg/store",
+					Tests:       []string{"TestGet"},
+					Path: []string{
+						"example.com/app/pkg/store.TestGet",
+						"example.com/app/pkg/store.Get",
+					},
+				},
+				{
+					Symbol:      "example.com/app/pkg/store.New",
+					Package:     "example.com/app/pkg/store",
+					TestPackage: "example.com/app/pkg/store",
+					Tests:       []string{"TestGet", "TestNew"},
+					Path: []string{
+						"example.com/app/pkg/store.TestGet",
+						"example.com/app/pkg/store.New",
+					},
+				},
+				{
+					Symbol:      "example.com/app/pkg/store.deep",
+					Package:     "example.com/app/pkg/store",
+					TestPackage: "example.com/app/pkg/store",
+					Tests:       []string{"TestGet"},
+					Path: []string{
+						"example.com/app/pkg/store.TestGet",
+						"example.com/app/pkg/store.Get",
+						"example.com/app/pkg/store.(*memory).Get",
+						"example.com/app/pkg/store.lookup",
+						"example.com/app/pkg/store.deep",
+					},
+				},
+				{
+					Symbol:      "example.com/app/pkg/store.lookup",
+					Package:     "example.com/app/pkg/store",
+					TestPackage: "example.com/app/pkg/store",
+					Tests:       []string{"TestGet"},
+					Path: []string{
+						"example.com/app/pkg/store.TestGet",
+						"example.com/app/pkg/store.Get",
+						"example.com/app/pkg/store.(*memory).Get",
+						"example.com/app/pkg/store.lookup",
+					},
+				},
+			},
+		},
+		{
+			name:     "depth limit",
+			maxDepth: 1,
+			want: []Reach{
+				{
+					Symbol:      "example.com/app/pkg/store.(*Cache[...]).Put",
+					Package:     "example.com/app/pkg/store",
+					TestPackage: "example.com/app/pkg/store",
+					Tests:       []string{"TestGet"},
+					Path: []string{
+						"example.com/app/pkg/store.TestGet",
+						"example.com/app/pkg/store.(*Cache[...]).Put",
+					},
+				},
+				{
+					Symbol:      "example.com/app/pkg/store.First[...]",
+					Package:     "example.com/app/pkg/store",
+					TestPackage: "example.com/app/pkg/store",
+					Tests:       []string{"TestGet"},
+					Path: []string{
+						"example.com/app/pkg/store.TestGet",
+						"example.com/app/pkg/store.First[...]",
+					},
+				},
+				{
+					Symbol:      "example.com/app/pkg/store.Get",
+					Package:     "example.com/app/pkg/store",
+					TestPackage: "example.com/app/pkg/store",
+					Tests:       []string{"TestGet"},
+					Path: []string{
+						"example.com/app/pkg/store.TestGet",
+						"example.com/app/pkg/store.Get",
+					},
+				},
+				{
+					Symbol:      "example.com/app/pkg/store.New",
+					Package:     "example.com/app/pkg/store",
+					TestPackage: "example.com/app/pkg/store",
+					Tests:       []string{"TestGet", "TestNew"},
+					Path: []string{
+						"example.com/app/pkg/store.TestGet",
+						"example.com/app/pkg/store.New",
+					},
+				},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Analyze(Options{
+				Dir:      dir,
+				Patterns: []string{"./..."},
+				Module:   "example.com/app",
+				MaxDepth: tt.maxDepth,
+			})
+			if err != nil {
+				t.Fatalf("Analyze() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Analyze() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
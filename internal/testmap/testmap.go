@@ -0,0 +1,71 @@
+package testmap
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"sort"
+
+	"gopkg.in/yaml.v2"
+)
+
+// FileSuffix is appended to the name of the metadata file
+// to get the name of the file holding the syscalls of each test.
+const FileSuffix = ".tests.yml"
+
+// Tests maps the tests (and subtests) to the syscalls
+// of the traced function they made.
+type Tests map[string][]string
+
+// Add adds the syscalls to the test, without duplicates.
+// The syscalls are kept sorted.
+func (t Tests) Add(test string, syscalls []string) {
+	for _, syscall := range syscalls {
+		if !slices.Contains(t[test], syscall) {
+			t[test] = append(t[test], syscall)
+		}
+	}
+	sort.Strings(t[test])
+}
+
+// Merge adds the syscalls of the other tests.
+func (t Tests) Merge(other Tests) {
+	for test, syscalls := range other {
+		t.Add(test, syscalls)
+	}
+}
+
+// Names returns the names of the tests, sorted.
+func (t Tests) Names() []string {
+	names := make([]string, 0, len(t))
+	for test := range t {
+		names = append(names, test)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Load reads the tests from the given file.
+func Load(path string) (Tests, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading tests %s: %w", path, err)
+	}
+	tests := make(Tests)
+	if err := yaml.Unmarshal(data, &tests); err != nil {
+		return nil, fmt.Errorf("error parsing tests %s: %v", path, err)
+	}
+	return tests, nil
+}
+
+// Save writes the tests to the given file.
+func (t Tests) Save(path string) error {
+	data, err := yaml.Marshal(t)
+	if err != nil {
+		return fmt.Errorf("error encoding tests: %v", err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("error writing tests %s: %v", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,49 @@
+package testmap
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestTests(t *testing.T) {
+	tests := make(Tests)
+	tests.Add("TestRead", []string{"read", "openat", "read"})
+	tests.Add("TestRead/empty", []string{"openat"})
+
+	other := Tests{
+		"TestRead":  {"close"},
+		"TestWrite": {"write"},
+	}
+	tests.Merge(other)
+
+	want := Tests{
+		"TestRead":       {"close", "openat", "read"},
+		"TestRead/empty": {"openat"},
+		"TestWrite":      {"write"},
+	}
+	if !reflect.DeepEqual(tests, want) {
+		t.Errorf("Tests = %v, want %v", tests, want)
+	}
+	if got, want := tests.Names(), []string{"TestRead", "TestRead/empty", "TestWrite"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Names() = %v, want %v", got, want)
+	}
+}
+
+func TestSaveLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "main.doSomething"+FileSuffix)
+	tests := Tests{
+		"TestRead":       {"openat", "read"},
+		"TestRead/empty": {"openat"},
+	}
+	if err := tests.Save(path); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	got, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if !reflect.DeepEqual(got, tests) {
+		t.Errorf("Load() = %v, want %v", got, tests)
+	}
+}
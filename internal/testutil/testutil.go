@@ -0,0 +1,32 @@
+// Package testutil provides the helpers shared by the tests of the packages.
+package testutil
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/tools/txtar"
+)
+
+// ExtractArchive writes the files of the txtar archive
+// (eg. testdata/module.txtar) into a temporary directory,
+// which is returned.
+func ExtractArchive(t testing.TB, archive string) string {
+	t.Helper()
+	ar, err := txtar.ParseFile(archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	for _, file := range ar.Files {
+		path := filepath.Join(dir, file.Name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, file.Data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
@@ -1,12 +1,18 @@
 package writer
 
 import (
+	"errors"
 	"fmt"
+	"io"
+	"io/fs"
 	"os"
 	"path"
 
 	"github.com/alegrey91/harpoon/internal/archiver"
 	"github.com/alegrey91/harpoon/internal/seccomputils"
+	"github.com/alegrey91/harpoon/internal/stability"
+	"github.com/alegrey91/harpoon/internal/syscallutils"
+	"github.com/alegrey91/harpoon/internal/testmap"
 )
 
 type WriteOptions struct {
@@ -16,38 +22,129 @@ type WriteOptions struct {
 }
 
 func Write(syscalls []uint32, functionSymbol string, opts WriteOptions) error {
-	var errOut error
-	if opts.Save {
-		fileName := archiver.Convert(functionSymbol)
-		if opts.FileName != "" {
-			fileName = opts.FileName
-		}
-		if fileName == "" {
-			return fmt.Errorf("file name is empty")
-		}
-		err := os.MkdirAll(opts.Directory, os.ModePerm)
-		if err != nil {
-			return fmt.Errorf("error creating directory: %v", err)
-		}
-		path := path.Join(opts.Directory, fileName)
-		file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
-		if err != nil {
-			return fmt.Errorf("error creating file %s: %v", path, err)
+	w, closeFn, err := open(functionSymbol, opts)
+	if err != nil {
+		return err
+	}
+	defer closeFn()
+
+	if err := seccomputils.Print(w, syscalls); err != nil {
+		return fmt.Errorf("error printing out system calls: %v", err)
+	}
+
+	return nil
+}
+
+// WriteIOUringOps writes the io_uring operations submitted by the function
+// next to its system calls, prefixed by syscallutils.IOUringOpPrefix.
+func WriteIOUringOps(ops []string, functionSymbol string, opts WriteOptions) error {
+	w, closeFn, err := open(functionSymbol, opts)
+	if err != nil {
+		return err
+	}
+	defer closeFn()
+
+	for _, op := range ops {
+		if _, err := fmt.Fprintln(w, syscallutils.IOUringOpPrefix+op); err != nil {
+			return fmt.Errorf("error printing out io_uring operations: %v", err)
 		}
-		defer file.Close()
+	}
+
+	return nil
+}
+
+// WriteStats saves the stats of the runs next to the metadata file
+// of the function, merging them with the existing ones.
+// Nothing is written when the results are not saved.
+func WriteStats(stats *stability.Stats, functionSymbol string, opts WriteOptions) error {
+	if !opts.Save {
+		return nil
+	}
+	path, err := filePath(functionSymbol, opts)
+	if err != nil {
+		return err
+	}
+	path += stability.FileSuffix
 
-		if err := file.Chmod(0744); err != nil {
-			return fmt.Errorf("error setting permissions to %s: %v", path, err)
+	existing, err := stability.Load(path)
+	switch {
+	case err == nil:
+		existing.Merge(stats)
+		stats = existing
+	case !errors.Is(err, fs.ErrNotExist):
+		return err
+	}
+	return stats.Save(path)
+}
+
+// WriteTests writes the syscalls made by each test,
+// next to the metadata file of the function (merging them with the existing ones)
+// in case they must be saved, on stdout otherwise.
+func WriteTests(tests testmap.Tests, functionSymbol string, opts WriteOptions) error {
+	if !opts.Save {
+		for _, test := range tests.Names() {
+			fmt.Printf("test: %s\n", test)
+			for _, syscall := range tests[test] {
+				fmt.Printf("  %s\n", syscall)
+			}
 		}
-		// write to file
-		errOut = seccomputils.Print(file, syscalls)
-	} else {
+		return nil
+	}
+	path, err := filePath(functionSymbol, opts)
+	if err != nil {
+		return err
+	}
+	path += testmap.FileSuffix
+
+	existing, err := testmap.Load(path)
+	switch {
+	case err == nil:
+		existing.Merge(tests)
+		tests = existing
+	case !errors.Is(err, fs.ErrNotExist):
+		return err
+	}
+	return tests.Save(path)
+}
+
+// open returns the writer where the results of the function are written:
+// the metadata file in case they must be saved, stdout otherwise.
+func open(functionSymbol string, opts WriteOptions) (io.Writer, func(), error) {
+	if !opts.Save {
 		// write to stdout
-		errOut = seccomputils.Print(os.Stdout, syscalls)
+		return os.Stdout, func() {}, nil
 	}
-	if errOut != nil {
-		return fmt.Errorf("error printing out system calls: %v", errOut)
+
+	path, err := filePath(functionSymbol, opts)
+	if err != nil {
+		return nil, nil, err
+	}
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error creating file %s: %v", path, err)
 	}
 
-	return nil
+	if err := file.Chmod(0744); err != nil {
+		file.Close()
+		return nil, nil, fmt.Errorf("error setting permissions to %s: %v", path, err)
+	}
+	// write to file
+	return file, func() { file.Close() }, nil
+}
+
+// filePath returns the path of the metadata file of the function,
+// creating its directory if needed.
+func filePath(functionSymbol string, opts WriteOptions) (string, error) {
+	fileName := archiver.Convert(functionSymbol)
+	if opts.FileName != "" {
+		fileName = opts.FileName
+	}
+	if fileName == "" {
+		return "", fmt.Errorf("file name is empty")
+	}
+	err := os.MkdirAll(opts.Directory, os.ModePerm)
+	if err != nil {
+		return "", fmt.Errorf("error creating directory: %v", err)
+	}
+	return path.Join(opts.Directory, fileName), nil
 }
@@ -0,0 +1,68 @@
+// Package harpoon is the public API of harpoon, to embed it in other tools.
+//
+// A Session traces the system calls made by a function symbol
+// while running a command (or within an already running process),
+// streaming them as typed events:
+//
+//	session, err := harpoon.NewSession(harpoon.Options{
+//		Symbol:  "main.doSomething",
+//		Command: []string{"./command", "arg1"},
+//	})
+//	if err != nil {
+//		return err
+//	}
+//	defer session.Close()
+//
+//	events, err := session.Start(ctx)
+//	if err != nil {
+//		return err
+//	}
+//	for e := range events {
+//		fmt.Println(e.Syscall)
+//	}
+//	result, err := session.Wait()
+//
+// FunctionSymbols finds the symbols to be traced within a binary,
+// and BuildProfile turns the traced system calls into a seccomp profile.
+//
+// Loading the ebpf programs requires root privileges (or CAP_BPF and CAP_PERFMON).
+// Nothing is printed: the failures are returned as *Error.
+package harpoon
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/alegrey91/harpoon/internal/ebpf/probesfacade/captor"
+)
+
+var (
+	// ErrPermission is returned when the ebpf programs
+	// can't be loaded because of missing privileges.
+	ErrPermission = captor.ErrPermission
+	// ErrInvalidOptions is returned when the options are incomplete or inconsistent.
+	ErrInvalidOptions = errors.New("invalid options")
+	// ErrAlreadyStarted is returned when starting a session twice.
+	ErrAlreadyStarted = errors.New("session already started")
+	// ErrNotStarted is returned when waiting for a session never started.
+	ErrNotStarted = errors.New("session not started")
+	// ErrUnknownSyscall is returned when a system call doesn't exist.
+	ErrUnknownSyscall = errors.New("unknown system call")
+)
+
+// Error is the error returned by the package.
+// Use errors.Is to check it against the Err variables.
+type Error struct {
+	// Op is the operation that failed (eg. "load probes").
+	Op string
+	// Err is the cause.
+	Err error
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("harpoon: %s: %v", e.Op, e.Err)
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
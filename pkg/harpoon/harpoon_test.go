@@ -0,0 +1,91 @@
+package harpoon
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"slices"
+	"testing"
+)
+
+func TestNewSessionInvalidOptions(t *testing.T) {
+	tests := []struct {
+		name string
+		opts Options
+	}{
+		{
+			name: "missing symbol",
+			opts: Options{Command: []string{"./command"}},
+		},
+		{
+			name: "missing command",
+			opts: Options{Symbol: "main.main"},
+		},
+		{
+			name: "command and pid",
+			opts: Options{Symbol: "main.main", Command: []string{"./command"}, AttachPID: 1},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewSession(tt.opts)
+			var harpoonErr *Error
+			if !errors.As(err, &harpoonErr) || !errors.Is(err, ErrInvalidOptions) {
+				t.Errorf("NewSession() error = %v, want %v", err, ErrInvalidOptions)
+			}
+		})
+	}
+}
+
+func TestBuildProfile(t *testing.T) {
+	data, err := BuildProfile([]string{"write", "read"}, ProfileOptions{Sets: []SyscallSet{SetStaticGo}})
+	if err != nil {
+		t.Fatalf("BuildProfile() error = %v", err)
+	}
+	var profile struct {
+		Architectures []string `json:"architectures"`
+		Syscalls      []struct {
+			Names []string `json:"names"`
+		} `json:"syscalls"`
+	}
+	if err := json.Unmarshal(data, &profile); err != nil {
+		t.Fatalf("BuildProfile() returned invalid JSON: %v", err)
+	}
+	if !slices.Equal(profile.Architectures, DefaultArchitectures) {
+		t.Errorf("architectures = %v, want %v", profile.Architectures, DefaultArchitectures)
+	}
+	var names []string
+	for _, rule := range profile.Syscalls {
+		names = append(names, rule.Names...)
+	}
+	for _, syscall := range []string{"read", "write"} {
+		if !slices.Contains(names, syscall) {
+			t.Errorf("syscalls = %v, want %s", names, syscall)
+		}
+	}
+
+	if _, err := BuildProfile([]string{"nonexistent"}, ProfileOptions{}); !errors.Is(err, ErrUnknownSyscall) {
+		t.Errorf("BuildProfile() error = %v, want %v", err, ErrUnknownSyscall)
+	}
+	if _, err := BuildProfile(nil, ProfileOptions{Sets: []SyscallSet{"nonexistent"}}); !errors.Is(err, ErrInvalidOptions) {
+		t.Errorf("BuildProfile() error = %v, want %v", err, ErrInvalidOptions)
+	}
+}
+
+func TestFunctionSymbols(t *testing.T) {
+	self, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	symbols, err := FunctionSymbols(self, "github.com/alegrey91/harpoon/pkg/harpoon.")
+	if err != nil {
+		t.Fatalf("FunctionSymbols() error = %v", err)
+	}
+	if !slices.Contains(symbols, "github.com/alegrey91/harpoon/pkg/harpoon.BuildProfile") {
+		t.Errorf("FunctionSymbols() = %v, want BuildProfile", symbols)
+	}
+
+	if _, err := FunctionSymbols("/nonexistent", ""); err == nil {
+		t.Errorf("FunctionSymbols() error = nil, want error")
+	}
+}
@@ -0,0 +1,89 @@
+package harpoon
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+
+	seccomp "github.com/alegrey91/harpoon/internal/seccomputils"
+	"github.com/alegrey91/harpoon/internal/syscallutils"
+)
+
+// SyscallSet is a set of system calls needed by a kind of program,
+// regardless of the traced functions.
+type SyscallSet string
+
+const (
+	// SetDynamicGo holds the system calls of dynamically linked Go programs.
+	SetDynamicGo SyscallSet = "dynamic"
+	// SetStaticGo holds the system calls of statically linked Go programs.
+	SetStaticGo SyscallSet = "static"
+	// SetDocker holds the system calls needed by docker to start the container.
+	SetDocker SyscallSet = "docker"
+)
+
+var syscallSets = map[SyscallSet][]string{
+	SetDynamicGo: syscallutils.MinDynamicGoSyscallSet,
+	SetStaticGo:  syscallutils.MinStaticGoSyscallSet,
+	SetDocker:    syscallutils.MinDockerSyscallSet,
+}
+
+// DefaultArchitectures are the architectures of the profile, when not set.
+var DefaultArchitectures = []string{"SCMP_ARCH_X86_64", "SCMP_ARCH_X86", "SCMP_ARCH_X32"}
+
+// ProfileOptions configures the profile built by BuildProfile.
+type ProfileOptions struct {
+	// Architectures of the profile, DefaultArchitectures if empty.
+	Architectures []string
+	// Sets are added to the system calls of the profile.
+	Sets []SyscallSet
+	// Variants adds the variants of the system calls (eg. openat for open).
+	Variants bool
+}
+
+// BuildProfile returns the seccomp profile (in JSON format)
+// allowing the given system calls.
+func BuildProfile(syscalls []string, opts ProfileOptions) ([]byte, error) {
+	var allowed []string
+	add := func(syscall string) {
+		if !slices.Contains(allowed, syscall) {
+			allowed = append(allowed, syscall)
+		}
+	}
+
+	for _, set := range opts.Sets {
+		setSyscalls, ok := syscallSets[set]
+		if !ok {
+			return nil, &Error{Op: "build profile", Err: fmt.Errorf("%w: unknown syscall set %q", ErrInvalidOptions, set)}
+		}
+		// the sets include system calls missing on some architectures.
+		for _, syscall := range setSyscalls {
+			if seccomp.IsValidSyscall(syscall) {
+				add(syscall)
+			}
+		}
+	}
+	for _, syscall := range syscalls {
+		if !seccomp.IsValidSyscall(syscall) {
+			return nil, &Error{Op: "build profile", Err: fmt.Errorf("%w: %s", ErrUnknownSyscall, syscall)}
+		}
+		if variants := syscallutils.GetVariants(syscall); opts.Variants && len(variants) > 0 {
+			for _, variant := range variants {
+				add(variant)
+			}
+			continue
+		}
+		add(syscall)
+	}
+	sort.Strings(allowed)
+
+	architectures := opts.Architectures
+	if len(architectures) == 0 {
+		architectures = DefaultArchitectures
+	}
+	profile, err := seccomp.BuildProfile(allowed, architectures)
+	if err != nil {
+		return nil, &Error{Op: "build profile", Err: err}
+	}
+	return []byte(profile), nil
+}
@@ -0,0 +1,251 @@
+package harpoon
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"sync"
+	"syscall"
+
+	"github.com/alegrey91/harpoon/internal/ebpf/probesfacade/captor"
+	"github.com/alegrey91/harpoon/internal/executor"
+	"github.com/alegrey91/harpoon/internal/recorder"
+	seccomp "github.com/alegrey91/harpoon/internal/seccomputils"
+	"github.com/alegrey91/harpoon/internal/syscallutils"
+)
+
+// EventKind is the kind of a captured event.
+type EventKind int
+
+const (
+	// EventSyscall is a system call made by the traced function.
+	EventSyscall EventKind = iota
+	// EventIOUring is an io_uring operation submitted by the traced function,
+	// which doesn't pass through the system calls.
+	EventIOUring
+)
+
+// Event is a single event captured during the session.
+type Event struct {
+	Kind EventKind
+	// Symbol is the traced function symbol.
+	Symbol string
+	// ID is the number of the system call,
+	// or the opcode of the io_uring operation.
+	ID uint32
+	// Syscall is the name of the system call, or of the io_uring operation.
+	// It's empty if the system call is unknown.
+	Syscall   string
+	PID       uint32
+	TID       uint32
+	Timestamp uint64
+	// Args are the raw arguments of the system call.
+	Args []uint64
+	// Test is the test running the function, with Options.PerTest.
+	Test string
+}
+
+// Options configures a Session.
+type Options struct {
+	// Symbol is the function symbol to be traced (eg. main.doSomething).
+	Symbol string
+	// Command is the command to be executed,
+	// the first argument being the binary containing the symbol.
+	Command []string
+	// Env are the additional KEY=VALUE variables of the command.
+	Env []string
+	// CleanEnv passes only Env to the command, instead of adding it to ours.
+	CleanEnv bool
+	// Dir is the working directory of the command.
+	Dir string
+	// Credential, when set, is the user and group the command is executed as.
+	Credential *syscall.Credential
+	// StdoutFile and StderrFile, when set, receive the output of the command,
+	// which is discarded otherwise.
+	StdoutFile string
+	StderrFile string
+	// AttachPID traces an already running process, instead of executing Command.
+	AttachPID int
+	// CgroupPath restricts the capture to the processes of the cgroup (v2).
+	CgroupPath string
+	// FollowGoroutines charges to the function the system calls
+	// of the goroutines it spawns.
+	FollowGoroutines bool
+	// PerTest sets the test running the function in the events,
+	// when Command is a Go test binary.
+	PerTest bool
+}
+
+// Result is the outcome of a session.
+type Result struct {
+	// Syscalls are the names of the system calls made by the function,
+	// sorted and without duplicates.
+	Syscalls []string
+	// IOUringOps are the io_uring operations submitted by the function.
+	IOUringOps []string
+	// ExitCode is the exit status of the command (0 when attached to a process).
+	ExitCode int
+}
+
+// eventsBuffer is the size of the events channel.
+const eventsBuffer = 256
+
+// Session traces a function symbol during the execution of a command.
+// A Session can be started once, and must be closed.
+type Session struct {
+	opts   Options
+	ebpf   *captor.EbpfSetup
+	events chan Event
+
+	mu      sync.Mutex
+	started bool
+	ctx     context.Context
+	done    chan struct{}
+	result  *Result
+	err     error
+}
+
+// NewSession validates the options and loads the ebpf programs,
+// attaching the probes to the function symbol.
+func NewSession(opts Options) (*Session, error) {
+	if opts.Symbol == "" {
+		return nil, &Error{Op: "new session", Err: fmt.Errorf("%w: missing symbol", ErrInvalidOptions)}
+	}
+	if len(opts.Command) == 0 && opts.AttachPID == 0 {
+		return nil, &Error{Op: "new session", Err: fmt.Errorf("%w: missing command or pid", ErrInvalidOptions)}
+	}
+	if len(opts.Command) > 0 && opts.AttachPID > 0 {
+		return nil, &Error{Op: "new session", Err: fmt.Errorf("%w: command and pid are mutually exclusive", ErrInvalidOptions)}
+	}
+
+	s := &Session{
+		opts:   opts,
+		events: make(chan Event, eventsBuffer),
+		done:   make(chan struct{}),
+	}
+	ebpf, err := captor.InitProbes(opts.Symbol, opts.Command, opts.Env, captor.CaptureOptions{
+		OnEvent:          s.emit,
+		CgroupPath:       opts.CgroupPath,
+		AttachPID:        opts.AttachPID,
+		FollowGoroutines: opts.FollowGoroutines,
+		PerTest:          opts.PerTest,
+		StdoutFile:       opts.StdoutFile,
+		StderrFile:       opts.StderrFile,
+		Credential:       opts.Credential,
+		Dir:              opts.Dir,
+		CleanEnv:         opts.CleanEnv,
+	})
+	if err != nil {
+		// the missing privileges are reported as ErrPermission.
+		return nil, &Error{Op: "load probes", Err: err}
+	}
+	s.ebpf = ebpf
+	return s, nil
+}
+
+// Start executes the command (or waits for the attached process),
+// returning the channel of the captured events.
+// The channel is closed once the capture is completed:
+// it must be drained, otherwise the capture is blocked.
+// When the context is done, the command is terminated.
+func (s *Session) Start(ctx context.Context) (<-chan Event, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.started {
+		return nil, &Error{Op: "start", Err: ErrAlreadyStarted}
+	}
+	s.started = true
+	s.ctx = ctx
+
+	go s.capture(ctx)
+	return s.events, nil
+}
+
+// Wait waits for the session to complete, returning its result.
+// A failing command is not an error: its status is in Result.ExitCode.
+// A command which could not be started is.
+func (s *Session) Wait() (*Result, error) {
+	s.mu.Lock()
+	started := s.started
+	s.mu.Unlock()
+	if !started {
+		return nil, &Error{Op: "wait", Err: ErrNotStarted}
+	}
+	<-s.done
+	return s.result, s.err
+}
+
+// Close releases the ebpf programs.
+// It must be called once the session is completed.
+func (s *Session) Close() {
+	s.ebpf.Close()
+}
+
+// capture runs the capture, storing its result.
+func (s *Session) capture(ctx context.Context) {
+	defer close(s.done)
+	defer close(s.events)
+
+	resultCh := make(chan []uint32)
+	errorCh := make(chan error)
+	go s.ebpf.Capture(ctx, resultCh, errorCh)
+
+	var ids []uint32
+	for syscalls := range resultCh {
+		ids = append(ids, syscalls...)
+	}
+	if err := <-errorCh; err != nil {
+		s.err = &Error{Op: "capture", Err: err}
+		return
+	}
+
+	// the command which could not be started has no exit status.
+	var startErr *executor.StartError
+	if errors.As(s.ebpf.CommandErr(), &startErr) {
+		s.err = &Error{Op: "start command", Err: startErr.Err}
+		return
+	}
+
+	names, err := seccomp.Names(ids)
+	if err != nil {
+		s.err = &Error{Op: "capture", Err: fmt.Errorf("%w: %v", ErrUnknownSyscall, err)}
+		return
+	}
+	sort.Strings(names)
+	result := &Result{
+		Syscalls:   slices.Compact(names),
+		IOUringOps: s.ebpf.IOUringOps(),
+	}
+	if s.opts.AttachPID == 0 {
+		result.ExitCode = executor.ExitCode(s.ebpf.CommandErr())
+	}
+	s.result = result
+}
+
+// emit sends the raw event to the events channel,
+// unless the session is being stopped.
+func (s *Session) emit(re recorder.Event) {
+	e := Event{
+		Kind:      EventSyscall,
+		Symbol:    re.Symbol,
+		ID:        re.SyscallID,
+		PID:       re.PID,
+		TID:       re.TID,
+		Timestamp: re.Timestamp,
+		Args:      re.Args,
+		Test:      re.Test,
+	}
+	if re.Kind == recorder.KindIOUring {
+		e.Kind = EventIOUring
+		e.Syscall = syscallutils.IOUringOpName(re.SyscallID)
+	} else if names, err := seccomp.Names([]uint32{re.SyscallID}); err == nil {
+		e.Syscall = names[0]
+	}
+
+	select {
+	case s.events <- e:
+	case <-s.ctx.Done():
+	}
+}
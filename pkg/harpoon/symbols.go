@@ -0,0 +1,22 @@
+package harpoon
+
+import (
+	"github.com/alegrey91/harpoon/internal/elfreader"
+)
+
+// FunctionSymbols returns the function symbols of the binary containing pattern
+// (usually the module path), which can be traced by a Session.
+// Test functions and anonymous functions are excluded.
+func FunctionSymbols(binPath, pattern string) ([]string, error) {
+	reader, err := elfreader.NewElfReader(binPath)
+	if err != nil {
+		return nil, &Error{Op: "read symbols", Err: err}
+	}
+	defer reader.Close()
+
+	symbols, err := reader.FunctionSymbols(pattern)
+	if err != nil {
+		return nil, &Error{Op: "read symbols", Err: err}
+	}
+	return symbols, nil
+}